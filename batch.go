@@ -0,0 +1,44 @@
+package main
+
+// BatchAggregation 决定ExecuteBatch如何将一批请求的结果汇总为一次成功或失败
+type BatchAggregation uint32
+
+const (
+	BatchAllSuccess BatchAggregation = 1 // 所有请求都成功时记为成功，任意一个失败时记为失败
+	BatchAnySuccess BatchAggregation = 2 // 任意一个请求成功时记为成功，全部失败时才记为失败
+)
+
+// ExecuteBatch 对一批请求只做一次放行判断，放行后依次执行fns，并按配置的BatchAggregation记录一次汇总结果
+// 返回每个请求的结果，请求被熔断器拒绝时返回nil和对应的错误
+func (cb *CircuitBreaker) ExecuteBatch(fns []func() bool) ([]bool, error) {
+	cycle, err := cb.beforeExecute(cb.now())
+	if err != nil {
+		return nil, err
+	}
+	defer cb.leaveConcurrency()
+	results := make([]bool, len(fns))
+	for i, f := range fns {
+		results[i] = f()
+	}
+	cb.afterExecute(cycle, cb.aggregate(results), cb.now())
+	return results, nil
+}
+
+func (cb *CircuitBreaker) aggregate(results []bool) bool {
+	switch cb.batchAggregation {
+	case BatchAnySuccess:
+		for _, ok := range results {
+			if ok {
+				return true
+			}
+		}
+		return len(results) == 0
+	default:
+		for _, ok := range results {
+			if !ok {
+				return false
+			}
+		}
+		return true
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestCircuitBreakerExecuteBatch(t *testing.T) {
+	ok := func() bool { return true }
+	ko := func() bool { return false }
+	mixed := []func() bool{ok, ko, ok}
+
+	// 默认任意一个失败即记为失败
+	cb := NewCircuitBreaker(60, 2)
+	for i := 0; i < 2; i++ {
+		results, err := cb.ExecuteBatch(mixed)
+		if err != nil || len(results) != 3 || !results[0] || results[1] || !results[2] {
+			t.Fatal(results, err)
+		}
+		// 一批请求只占用一次放行
+		if i == 0 && cb.s.requests != 1 {
+			t.Fatal(cb.s.requests)
+		}
+	}
+	if cb.state != StateOpen {
+		t.Fatal(cb.state)
+	}
+	executed := false
+	results, err := cb.ExecuteBatch([]func() bool{func() bool {
+		executed = true
+		return true
+	}})
+	if err != ErrOpenState || results != nil || executed {
+		t.Fatal(results, err, executed)
+	}
+
+	// 任意一个成功即记为成功
+	cb = NewCircuitBreaker(60, 2, WithBatchAggregation(BatchAnySuccess))
+	for i := 0; i < 5; i++ {
+		if _, err := cb.ExecuteBatch(mixed); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cb.state != StateClosed || cb.s.successes != 5 {
+		t.Fatal(cb.state, cb.s.successes)
+	}
+	for i := 0; i < 2; i++ {
+		_, _ = cb.ExecuteBatch([]func() bool{ko, ko})
+	}
+	if cb.state != StateOpen {
+		t.Fatal(cb.state)
+	}
+}
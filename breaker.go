@@ -0,0 +1,16 @@
+package main
+
+// Breaker 熔断器的接口，*CircuitBreaker实现了该接口
+// 建议依赖熔断器的代码使用Breaker而不是*CircuitBreaker，便于在测试中替换为其它实现
+type Breaker interface {
+	Name() string
+	Execute(f func() bool) error
+	ExecuteResult(f func() (bool, error)) error
+	RecordSuccess()
+	RecordFailure()
+	State() uint32
+	Counts() Counts
+	Reset()
+}
+
+var _ Breaker = (*CircuitBreaker)(nil)
@@ -0,0 +1,46 @@
+//go:build go1.18
+
+package main
+
+// Cache ExecuteWithCache保存最近一次成功结果使用的缓存，实现需要是并发安全的
+type Cache interface {
+	// Get 返回key对应的值，不存在时ok为false
+	Get(key string) (value interface{}, ok bool)
+	// Set 保存key对应的值
+	Set(key string, value interface{})
+}
+
+// ExecuteWithCache 经过cb的放行判断后执行f，f的结果和错误按WithOutcomeFunc配置的函数判断(未配置时err为nil计为成功)，
+// 计为成功并且err为nil时将结果保存到cache
+// 请求被熔断器拒绝(例如熔断器处于开启状态)时不执行f，cache中有key对应的值时返回该值和nil，即降级为返回最近一次成功的结果；
+// 没有缓存的值时返回零值和拒绝的错误。适用于可以接受陈旧数据的读接口
+func ExecuteWithCache[T any](cb *CircuitBreaker, key string, f func() (T, error), cache Cache) (T, error) {
+	cycle, err := cb.beforeExecute(cb.now())
+	if err != nil {
+		if cached, ok := cache.Get(key); ok {
+			if v, ok := cached.(T); ok {
+				return v, nil
+			}
+		}
+		var zero T
+		return zero, err
+	}
+	defer cb.leaveConcurrency()
+	start := cb.slowStart()
+	v, err := f()
+	switch cb.classify(v, err) {
+	case OutcomeIgnore:
+		cb.cancel(cycle)
+	case OutcomeSuccess:
+		cb.afterExecute(cycle, true, cb.now())
+		cb.observeLatency(cycle, start, cb.now(), true)
+		if err == nil {
+			cache.Set(key, v)
+		}
+	default:
+		cb.recordError(err)
+		cb.afterExecute(cycle, false, cb.now())
+		cb.observeLatency(cycle, start, cb.now(), false)
+	}
+	return v, err
+}
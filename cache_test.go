@@ -0,0 +1,105 @@
+//go:build go1.18
+
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+type mapCache struct {
+	mu sync.Mutex
+	m  map[string]interface{}
+}
+
+func (c *mapCache) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.m[key]
+	return v, ok
+}
+
+func (c *mapCache) Set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.m[key] = value
+}
+
+func TestExecuteWithCache(t *testing.T) {
+	cache := &mapCache{m: map[string]interface{}{}}
+	cb := NewCircuitBreaker(60, 2)
+	errDown := errors.New("down")
+	v, err := ExecuteWithCache(cb, "user:1", func() (string, error) { return "alice", nil }, cache)
+	if v != "alice" || err != nil {
+		t.Fatal(v, err)
+	}
+	for i := 0; i < 2; i++ {
+		v, err = ExecuteWithCache(cb, "user:1", func() (string, error) { return "", errDown }, cache)
+		if v != "" || err != errDown {
+			t.Fatal(v, err)
+		}
+	}
+	RequireState(t, cb, StateOpen)
+
+	// 开启状态下返回缓存的值，不执行f
+	called := false
+	v, err = ExecuteWithCache(cb, "user:1", func() (string, error) {
+		called = true
+		return "bob", nil
+	}, cache)
+	if v != "alice" || err != nil || called {
+		t.Fatal(v, err, called)
+	}
+	// 没有缓存的值时返回拒绝的错误
+	v, err = ExecuteWithCache(cb, "user:2", func() (string, error) { return "bob", nil }, cache)
+	if v != "" || err != ErrOpenState {
+		t.Fatal(v, err)
+	}
+	// 缓存的值类型不同时视为没有缓存
+	n, err := ExecuteWithCache(cb, "user:1", func() (int, error) { return 1, nil }, cache)
+	if n != 0 || err != ErrOpenState {
+		t.Fatal(n, err)
+	}
+}
+
+func TestExecuteWithCacheOutcomeFunc(t *testing.T) {
+	errNotFound := errors.New("not found")
+	errCanceled := errors.New("canceled")
+	cache := &mapCache{m: map[string]interface{}{}}
+	cb := NewCircuitBreaker(60, 1, WithOutcomeFunc(func(result interface{}, err error) Outcome {
+		switch {
+		case err == errNotFound:
+			return OutcomeSuccess
+		case err == errCanceled:
+			return OutcomeIgnore
+		case err == nil && result == "":
+			return OutcomeFailure
+		case err == nil:
+			return OutcomeSuccess
+		}
+		return OutcomeFailure
+	}))
+	// 被判断为成功的错误不计为失败，也不写入缓存
+	if _, err := ExecuteWithCache(cb, "user:1", func() (string, error) { return "", errNotFound }, cache); err != errNotFound {
+		t.Fatal(err)
+	}
+	// 忽略的请求不计入统计
+	if _, err := ExecuteWithCache(cb, "user:1", func() (string, error) { return "", errCanceled }, cache); err != errCanceled {
+		t.Fatal(err)
+	}
+	if c := cb.Counts(); c.Requests != 1 || c.Successes != 1 || c.Failures != 0 {
+		t.Fatal(c)
+	}
+	if _, ok := cache.Get("user:1"); ok {
+		t.Fatal("cached a failed lookup")
+	}
+	// 不符合预期的结果计为失败，同样不写入缓存
+	if _, err := ExecuteWithCache(cb, "user:1", func() (string, error) { return "", nil }, cache); err != nil {
+		t.Fatal(err)
+	}
+	RequireState(t, cb, StateOpen)
+	if _, ok := cache.Get("user:1"); ok {
+		t.Fatal("cached a failed result")
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import "time"
+
+// Result Call的执行结果
+type Result struct {
+	// Admitted 请求是否被熔断器放行
+	Admitted bool
+	// Success f是否返回true，请求被拒绝时为false
+	Success bool
+	// Duration f的执行耗时，请求被拒绝时为0
+	Duration time.Duration
+	// StateAtCall 放行判断时熔断器的状态
+	StateAtCall uint32
+	// Err 与Execute的返回值相同：请求被拒绝时为对应的错误，放行时为nil(配置了WithCallFailedError且请求失败时为配置的错误)
+	Err error
+}
+
+// Call 与Execute相同，但一次性返回放行结果、请求结果、执行耗时和放行判断时的状态
+// 只需要错误时应使用Execute
+func (cb *CircuitBreaker) Call(f func() bool) Result {
+	state, cycle, err := cb.acquire(cb.now())
+	if err != nil {
+		return Result{StateAtCall: state, Err: err}
+	}
+	defer cb.leaveConcurrency()
+	start := cb.clock()
+	success, ignored := cb.invoke(f)
+	end := cb.clock()
+	if ignored {
+		cb.cancel(cycle)
+		return Result{Admitted: true, Duration: end.Sub(start), StateAtCall: state}
+	}
+	cb.afterExecute(cycle, success, cb.now())
+	if cb.timed() {
+		cb.observeLatency(cycle, start, cb.now(), success)
+	}
+	return Result{
+		Admitted:    true,
+		Success:     success,
+		Duration:    end.Sub(start),
+		StateAtCall: state,
+		Err:         cb.callError(success),
+	}
+}
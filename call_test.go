@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerCall(t *testing.T) {
+	cb := NewCircuitBreaker(60, 1)
+	r := cb.Call(func() bool {
+		time.Sleep(10 * time.Millisecond)
+		return false
+	})
+	if !r.Admitted || r.Success || r.Duration < 10*time.Millisecond || r.StateAtCall != StateClosed || r.Err != nil {
+		t.Fatal(r)
+	}
+	RequireState(t, cb, StateOpen)
+	r = cb.Call(func() bool { return true })
+	if r != (Result{StateAtCall: StateOpen, Err: ErrOpenState}) {
+		t.Fatal(r)
+	}
+	DriveToHalfOpen(cb)
+	r = cb.Call(func() bool { return true })
+	if !r.Admitted || !r.Success || r.StateAtCall != StateHalfOpen || r.Err != nil {
+		t.Fatal(r)
+	}
+	RequireState(t, cb, StateClosed)
+}
@@ -0,0 +1,65 @@
+package main
+
+import "sync"
+
+// 状态切换相关的回调(WithOnStateChange、Observer.StateChanged、WithSlog、WithFlapping)默认在触发状态切换的协程中同步调用，
+// 调用时不持有熔断器内部的任何锁。多个协程同时访问熔断器时，不同的状态切换可能在不同的协程中并发回调，
+// 先发生的切换的回调也可能晚于后发生的切换的回调执行。配置WithSerialCallbacks后这些回调改为按状态切换的顺序逐个执行
+// Observer的其它方法以及WithOnProbe等回调始终在请求所在的协程中同步调用，可能并发执行
+
+// callbackQueue 按加入的顺序逐个执行回调，有回调等待执行时启动一个协程，全部执行完后协程退出
+type callbackQueue struct {
+	// order 保证状态切换与回调加入队列的顺序一致
+	order   sync.Mutex
+	mu      sync.Mutex
+	pending []func()
+	running bool
+}
+
+func (q *callbackQueue) push(f func()) {
+	q.mu.Lock()
+	q.pending = append(q.pending, f)
+	if !q.running {
+		q.running = true
+		go q.run()
+	}
+	q.mu.Unlock()
+}
+
+func (q *callbackQueue) run() {
+	for {
+		q.mu.Lock()
+		if len(q.pending) == 0 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		f := q.pending[0]
+		q.pending[0] = nil
+		q.pending = q.pending[1:]
+		q.mu.Unlock()
+		f()
+	}
+}
+
+// dispatch 配置了WithSerialCallbacks时将f加入回调队列，否则直接调用f
+func (cb *CircuitBreaker) dispatch(f func()) {
+	if cb.callbacks != nil {
+		cb.callbacks.push(f)
+		return
+	}
+	f()
+}
+
+// stateChanged 调用状态切换的回调
+func (cb *CircuitBreaker) stateChanged(from, to uint32, reason Reason, counts Counts) {
+	if cb.onStateChange != nil {
+		cb.onStateChange(cb.name, from, to, reason, counts)
+	}
+	if cb.observer != nil {
+		cb.observer.StateChanged(cb.name, from, to, reason, counts)
+	}
+	if cb.logTransition != nil {
+		cb.logTransition(from, to, reason, counts)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerSerialCallbacks(t *testing.T) {
+	var mu sync.Mutex
+	var got []transition
+	var inCallback int32
+	cb := NewCircuitBreaker(60, 1, WithSerialCallbacks(), WithOnStateChange(func(name string, from, to uint32, reason Reason, counts Counts) {
+		if atomic.AddInt32(&inCallback, 1) != 1 {
+			t.Error("overlapping callbacks")
+		}
+		time.Sleep(time.Microsecond)
+		mu.Lock()
+		got = append(got, transition{from, to, reason})
+		mu.Unlock()
+		atomic.AddInt32(&inCallback, -1)
+	}))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				cb.Trip()
+				cb.Reset()
+			}
+		}()
+	}
+	wg.Wait()
+	transitions := int(cb.flaps.aggregate(cb.now()).successes)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(got)
+		mu.Unlock()
+		if n == transitions {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(n, transitions)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// 按状态切换的顺序回调，每次切换的起点是上一次切换的终点
+	state := StateClosed
+	for i, tr := range got {
+		if tr.from != state {
+			t.Fatal(i, tr, StateString(state))
+		}
+		state = tr.to
+	}
+	if state != cb.Peek() {
+		t.Fatal(StateString(state), StateString(cb.Peek()))
+	}
+}
+
+func TestCircuitBreakerSerialCallbacksReentrant(t *testing.T) {
+	done := make(chan struct{})
+	var cb *CircuitBreaker
+	cb = NewCircuitBreaker(60, 1, WithSerialCallbacks(), WithOnStateChange(func(name string, from, to uint32, reason Reason, counts Counts) {
+		switch to {
+		case StateOpen:
+			// 回调中再次切换状态不会死锁
+			cb.Reset()
+		case StateClosed:
+			close(done)
+		}
+	}))
+	cb.Trip()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback not delivered")
+	}
+	RequireState(t, cb, StateClosed)
+}
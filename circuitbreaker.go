@@ -2,6 +2,8 @@ package main
 
 import (
 	"errors"
+	"math"
+	"math/rand"
 	"sync/atomic"
 	"time"
 )
@@ -12,39 +14,130 @@ const (
 	StateOpen     uint32 = 3 // 开启状态，所有请求均不会执行
 )
 
+// 熔断器拒绝请求时返回的错误，调用方可以根据错误类型选择不同的处理方式：
+// ErrOpenState、ErrTooManyRequests、ErrShedding表示下游不健康，应当退避之后再重试；
+// ErrConcurrencyLimit只表示WithMaxConcurrency配置的本地并发名额已满，与下游是否健康无关，可以立即重试或转发到其它实例；
+// ErrShutdown表示熔断器已经通过Shutdown停止使用，重试没有意义
 var (
-	ErrTooManyRequests = errors.New("too many requests")
-	ErrOpenState       = errors.New("circuit breaker is open")
+	ErrTooManyRequests  = errors.New("too many requests")
+	ErrOpenState        = errors.New("circuit breaker is open")
+	ErrShedding         = errors.New("request is shed by circuit breaker")
+	ErrConcurrencyLimit = errors.New("circuit breaker concurrency limit reached")
+	ErrShutdown         = errors.New("circuit breaker is shut down")
+	ErrCallFailed       = errors.New("circuit breaker call failed")
 )
 
 // statistic ...
 type statistic struct {
 	requests            uint32 // 熔断器通过的请求数
-	continuousSuccesses uint32 // 连续成功的请求数
-	continuousFailures  uint32 // 连续失败的请求数
+	continuousSuccesses uint32 // 连续成功的请求数，最多累加到threshold
+	continuousFailures  uint32 // 连续失败的请求数，最多累加到threshold
+	rejections          uint32 // 半开启状态下因ErrTooManyRequests被拒绝的请求数
+	successes           uint32 // 成功的请求数
+	failures            uint32 // 失败的请求数
+	continuousSlowCalls uint32 // 连续的慢调用数，最多累加到slowCallCount
 }
 
-func (s *statistic) request() {
-	atomic.AddUint32(&s.requests, 1)
+func (s *statistic) request() uint32 {
+	return atomic.AddUint32(&s.requests, 1)
 }
 
-func (s *statistic) success() uint32 {
-	atomic.StoreUint32(&s.continuousFailures, 0)
-	return atomic.AddUint32(&s.continuousSuccesses, 1)
+// unrequest 撤销一次已经放行的请求
+func (s *statistic) unrequest() {
+	for {
+		requests := atomic.LoadUint32(&s.requests)
+		if requests == 0 || atomic.CompareAndSwapUint32(&s.requests, requests, requests-1) {
+			return
+		}
+	}
 }
 
-func (s *statistic) failure() uint32 {
-	atomic.StoreUint32(&s.continuousSuccesses, 0)
-	return atomic.AddUint32(&s.continuousFailures, 1)
+func (s *statistic) reject() {
+	atomic.AddUint32(&s.rejections, 1)
+}
+
+// success 记录一次成功，连续成功数最多累加到limit，避免长时间运行后溢出回绕
+// reset为true时同时清零连续失败数
+func (s *statistic) success(limit uint32, reset bool) uint32 {
+	return s.successN(limit, reset, 1)
+}
+
+// successN 与success相同，但一次记录n次成功
+func (s *statistic) successN(limit uint32, reset bool, n uint32) uint32 {
+	atomic.AddUint32(&s.successes, n)
+	if reset {
+		atomic.StoreUint32(&s.continuousFailures, 0)
+	}
+	_, continuous := saturatingAdd(&s.continuousSuccesses, n, limit)
+	return continuous
+}
+
+// failure 记录一次失败，连续失败数最多累加到limit
+func (s *statistic) failure(limit uint32) uint32 {
+	_, continuous := s.failureN(limit, 1)
+	return continuous
 }
 
-func (s *statistic) clear() {
-	atomic.StoreUint32(&s.requests, 0)
+// failureN 与failure相同，但一次记录n次失败，返回记录前后的连续失败数
+func (s *statistic) failureN(limit, n uint32) (before, after uint32) {
+	atomic.AddUint32(&s.failures, n)
 	atomic.StoreUint32(&s.continuousSuccesses, 0)
-	atomic.StoreUint32(&s.continuousFailures, 0)
+	return saturatingAdd(&s.continuousFailures, n, limit)
+}
+
+// saturatingIncrement 将addr加1，达到limit后不再增加，返回增加后的值
+func saturatingIncrement(addr *uint32, limit uint32) uint32 {
+	_, after := saturatingAdd(addr, 1, limit)
+	return after
+}
+
+// saturatingAdd 将addr加n，最多增加到limit，返回增加前后的值
+func saturatingAdd(addr *uint32, n, limit uint32) (before, after uint32) {
+	for {
+		old := atomic.LoadUint32(addr)
+		if old >= limit {
+			return old, old
+		}
+		v := limit
+		if n < limit-old {
+			v = old + n
+		}
+		if atomic.CompareAndSwapUint32(addr, old, v) {
+			return old, v
+		}
+	}
+}
+
+func (s *statistic) counts() Counts {
+	return Counts{
+		Requests:            atomic.LoadUint32(&s.requests),
+		ContinuousSuccesses: atomic.LoadUint32(&s.continuousSuccesses),
+		ContinuousFailures:  atomic.LoadUint32(&s.continuousFailures),
+		Successes:           atomic.LoadUint32(&s.successes),
+		Failures:            atomic.LoadUint32(&s.failures),
+		ContinuousSlowCalls: atomic.LoadUint32(&s.continuousSlowCalls),
+	}
+}
+
+// clear 清空统计数据，返回清空之前的数据，每一项的读取和清空都是原子的
+func (s *statistic) clear() Counts {
+	atomic.StoreUint32(&s.rejections, 0)
+	return Counts{
+		Requests:            atomic.SwapUint32(&s.requests, 0),
+		ContinuousSuccesses: atomic.SwapUint32(&s.continuousSuccesses, 0),
+		ContinuousFailures:  atomic.SwapUint32(&s.continuousFailures, 0),
+		Successes:           atomic.SwapUint32(&s.successes, 0),
+		Failures:            atomic.SwapUint32(&s.failures, 0),
+		ContinuousSlowCalls: atomic.SwapUint32(&s.continuousSlowCalls, 0),
+	}
 }
 
 type CircuitBreaker struct {
+	name string
+	// epoch 创建熔断器的时间，带有单调时钟读数，参考now
+	epoch time.Time
+	// since 返回从t开始经过的时间，默认使用包级别的Now，配置了WithClock时使用熔断器自己的时钟
+	since func(t time.Time) time.Duration
 	// state 熔断器状态
 	// 默认为关闭状态，连续失败超过阈值后切换到开启状态
 	// 关闭->开启：连续失败超过阈值
@@ -62,16 +155,183 @@ type CircuitBreaker struct {
 	s         *statistic
 
 	cycle uint32
+
+	// softThreshold 关闭状态下连续失败达到此值后开始按概率拒绝请求，0表示不开启
+	softThreshold uint32
+	// sheddingCurve 计算关闭状态下拒绝请求的概率
+	sheddingCurve SheddingCurve
+	// policy 决定各个状态下是否放行请求，未配置时使用defaultAdmissionPolicy
+	policy AdmissionPolicy
+	// window 关闭状态下的滑动窗口，配置后关闭状态下窗口内失败数超过threshold时熔断器开启
+	window *bucketedWindow
+	// shared 与其他熔断器共享的失败统计，共享统计中的失败数达到threshold时熔断器开启
+	shared *SharedStatistic
+	// saturationRatio 半开启状态下被拒绝的请求占比达到此值时，下一次开启的时间周期乘以saturationFactor，0表示不开启
+	saturationRatio  float64
+	saturationFactor int64
+	// onStateChange 状态切换成功后调用
+	onStateChange func(name string, from, to uint32, reason Reason, counts Counts)
+	// observer 接收熔断器生命周期内的各类事件
+	observer Observer
+	// callbacks 配置了WithSerialCallbacks时按顺序执行状态切换回调的队列
+	callbacks *callbackQueue
+	// logTransition 状态切换成功后输出日志，参考WithSlog
+	logTransition func(from, to uint32, reason Reason, counts Counts)
+	// lateSuccessStep 每个迟到的成功结果将下一次开启的时间周期缩短的秒数，0表示丢弃迟到的结果
+	lateSuccessStep int64
+	// recoveryHints 熔断器重新开启后迟到的成功结果数
+	recoveryHints uint32
+	// failureRatio 关闭状态下失败率达到此值并且请求数不少于minRequests时熔断器开启，0表示不开启
+	failureRatio float64
+	minRequests  uint32
+	// observationWeight 关闭状态下按失败率开启时平均每observationWeight个请求结果抽样记录一个，0或1表示记录全部结果
+	observationWeight uint32
+	// maxConcurrency 同时执行的请求数上限，超过时返回ErrConcurrencyLimit，0表示不限制
+	// inFlight 正在执行的请求数，只在maxConcurrency大于0时统计
+	maxConcurrency int32
+	inFlight       int32
+	// halfOpenSuccessRatio 半开启状态下请求数达到halfOpenMinRequests后，成功率达到此值时关闭熔断器，否则重新开启，0表示按连续成功数判断
+	halfOpenSuccessRatio float64
+	halfOpenMinRequests  uint32
+	// rampUp 半开启状态下默认放行策略按连续成功数使用的放行概率
+	rampUp []float64
+	// openSampling 开启状态下默认放行策略放行请求的概率，0表示不放行
+	openSampling float64
+	// openSampled 开启状态下放行判断放行的请求是否都是WithOpenSampling抽中的探测请求，
+	// 只有这些请求和ExecuteBypass的成功计入开启状态下的提前恢复
+	openSampled bool
+	// volume 计算失败率使用的滑动窗口，未配置时使用当前周期内的全部请求
+	volume *bucketedWindow
+	// batchAggregation ExecuteBatch汇总结果的方式，默认BatchAllSuccess
+	batchAggregation BatchAggregation
+	// rand 概率相关功能使用的随机数生成器，默认使用以创建时间为种子的rand.Rand
+	rand *lockedRand
+	// watchers 通过WaitForState等待状态切换的订阅者
+	watchers watchers
+	// probeTimeout 半开启状态下探测请求超过此时间(秒)未全部返回时视为失败，0表示不开启
+	probeTimeout int64
+	// probeStart 半开启状态下放行第一个探测请求的时间
+	probeStart int64
+	// staleProbeReset 半开启状态下超过此时间(秒)没有探测请求返回时归还未返回的请求占用的名额，0表示不开启
+	staleProbeReset int64
+	// lastProbeResolved 半开启状态下最近一次有探测请求返回(或放行第一个探测请求)的时间
+	lastProbeResolved int64
+	// limboTimeout 半开启状态持续超过此时间(秒)且仍有探测请求未返回时调用onLimbo，0表示不检测
+	limboTimeout int64
+	onLimbo      func(name string, counts Counts)
+	// limboCycle 最近一次调用onLimbo的周期
+	limboCycle uint32
+	// onProbe 每个半开启周期放行第一个探测请求时调用
+	onProbe func()
+	// probeCycle 最近一次调用onProbe的周期
+	probeCycle uint32
+	// successSpread 半开启状态下两次计入统计的成功之间至少间隔的秒数，0表示不限制
+	successSpread int64
+	// lastSpreadSuccess 半开启状态下上一次计入统计的成功的时间
+	lastSpreadSuccess int64
+	// successDecay 半开启状态下两次成功间隔超过此秒数时之前的连续成功失效，0表示不失效
+	successDecay int64
+	// lastHalfOpenSuccess 半开启状态下上一次成功的时间
+	lastHalfOpenSuccess int64
+	// halfOpenQueue 半开启状态下探测名额已满时请求等待名额的最长时间，0表示直接拒绝
+	halfOpenQueue time.Duration
+	// ignoreIsolatedFailures 关闭状态下紧接着成功的单次失败不计入开启熔断器的判断
+	ignoreIsolatedFailures bool
+	// resetFailuresOnSuccess 关闭状态下成功是否清零连续失败数，创建熔断器时根据配置确定
+	// resetFailuresConfigured 是否通过WithResetFailuresOnSuccess显式配置
+	resetFailuresOnSuccess  bool
+	resetFailuresConfigured bool
+	// shards 半开启状态下按分片记录的成功，配置后需要足够多不同的分片成功才会关闭
+	shards *probeShards
+	// slowCallDuration 执行耗时达到此值的请求视为慢调用，0表示不检测慢调用
+	slowCallDuration time.Duration
+	// slowCallCount 关闭状态下连续慢调用达到此值时熔断器开启
+	slowCallCount uint32
+	// latency 按百分位检测慢调用时最近请求耗时的样本，配置后取代slowCallDuration
+	latency *latencySampler
+	// onLatency 接收每个放行的请求的执行耗时和结果，参考WithLatencyObserver
+	onLatency func(name string, success bool, elapsed time.Duration)
+	// captureError 返回f最近一次失败的错误，isFailure判断该错误是否计为失败，参考WithErrorPredicate
+	captureError func() error
+	isFailure    func(err error) bool
+	// strategy 自定义的状态切换规则，nil表示使用内置规则
+	strategy TransitionStrategy
+	// tap 在计入统计之前转换请求的结果
+	tap func(success bool) bool
+	// outcome 判断Do执行的请求计入统计的方式，参考WithOutcomeFunc
+	outcome func(result interface{}, err error) Outcome
+	// recent 最近几次计为失败的请求的错误，参考RecentErrors
+	recent *recentErrors
+	// countFailure 请求失败时判断是否计入统计，参考WithCountFailure
+	countFailure func() bool
+	// callFailedError 放行的请求失败时Execute返回的错误，默认为nil
+	callFailedError error
+	// 自创建以来的累计数据，不随周期清空
+	totalSuccesses  uint64
+	totalFailures   uint64
+	totalRejections uint64
+	// probeBackoffFactor 每次恢复失败后下一次开启的时间周期乘以此值，0表示不开启
+	probeBackoffFactor int64
+	// probeBackoffMax 逐次延长的开启时间周期的上限，0表示不限制
+	probeBackoffMax int64
+	// failedProbes 自上一次关闭以来半开启状态恢复失败的次数
+	failedProbes uint32
+	// cooldownCredit 切换到关闭状态时给予的额度，每个额度抵消一次关闭状态下的失败，每次成功消耗一个额度，0表示不开启
+	cooldownCredit uint32
+	// credit 当前剩余的额度
+	credit uint32
+	// confirmWindow 半开启状态下满足恢复条件之后还需要持续没有失败的秒数，0表示立即关闭
+	confirmWindow int64
+	// confirmAt 半开启状态下确认窗口结束的时间，0表示还没有满足恢复条件
+	confirmAt int64
+	// startupGrace 创建熔断器之后的秒数，期间关闭状态下的失败和慢调用照常记录但不会开启熔断器，0表示不开启
+	startupGrace int64
+	// minClosedDuration 从半开启状态恢复到关闭状态之后的秒数，期间开启熔断器所需的失败数增加closedForgiveness，0表示不开启
+	minClosedDuration int64
+	closedForgiveness uint32
+	// recoveredAt 最近一次从半开启状态恢复到关闭状态的时间
+	recoveredAt int64
+	// maxOpenDuration 开启状态最长持续的秒数，超过后强制切换到半开启状态，0表示不限制
+	maxOpenDuration int64
+	// maxHalfOpenDuration 半开启状态最长持续的秒数，超过后强制切换到开启状态，maxHalfOpenClose为true时切换到关闭状态，0表示不限制
+	maxHalfOpenDuration int64
+	maxHalfOpenClose    bool
+	// flaps 最近一段时间内的状态切换次数，参考FlapRate
+	flaps *bucketedWindow
+	// flapThreshold 每分钟的状态切换次数超过此值时调用onFlapping
+	flapThreshold float64
+	onFlapping    func(name string, rate float64)
+	// fastPath Execute是否可以使用关闭状态下的快速路径，参考canFastPath
+	fastPath bool
+	// shutdown 是否已经调用Shutdown，1表示已经停止使用
+	shutdown uint32
+	// dwell 每个状态累计持续的时间，参考StateDurations
+	dwell dwell
+	// stateSince 切换到当前状态的时间
+	stateSince int64
+	// openCause 最近一次切换到开启状态的原因，参考OpenCause
+	openCause uint32
+	// healthCheck 半开启状态下关闭熔断器之前必须通过的健康检查，参考WithBaselineHealthCheck
+	healthCheck func() bool
+	// healthyCycle 最近一次通过健康检查的周期
+	healthyCycle uint32
+	// rejectSampleRate 被拒绝的请求中调用onRejectSample的比例，参考WithRejectSampler
+	rejectSampleRate float64
+	onRejectSample   func()
+	// rejectSamples 参与抽样的被拒绝的请求数
+	rejectSamples uint64
 }
 
-func NewCircuitBreaker(openInterval int64, threshold uint32) *CircuitBreaker {
+func NewCircuitBreaker(openInterval int64, threshold uint32, opts ...Option) *CircuitBreaker {
 	if openInterval <= 0 {
-		openInterval = 60
+		openInterval = loadDefaultOpenInterval()
 	}
 	if threshold <= 0 {
-		threshold = 5
+		threshold = loadDefaultThreshold()
 	}
-	return &CircuitBreaker{
+	cb := &CircuitBreaker{
+		epoch:        Now(),
+		since:        sinceNow,
 		state:        StateClosed,
 		openInterval: openInterval,
 		threshold:    threshold,
@@ -82,95 +342,986 @@ func NewCircuitBreaker(openInterval int64, threshold uint32) *CircuitBreaker {
 			continuousFailures:  0,
 		},
 		cycle: 0,
+		flaps: newBucketedWindow(flapBucketInterval, flapBuckets),
+	}
+	for _, opt := range loadDefaultOptions() {
+		opt(cb)
+	}
+	for _, opt := range opts {
+		opt(cb)
 	}
+	cb.stateSince = cb.now()
+	if cb.recent == nil {
+		cb.recent = newRecentErrors(defaultRecentErrors)
+	}
+	cb.dwell.since = cb.stateSince
+	if cb.rand == nil {
+		cb.rand = newLockedRand(rand.New(rand.NewSource(time.Now().UnixNano())))
+	}
+	if cb.policy == nil {
+		cb.policy = &defaultAdmissionPolicy{
+			rand:             cb.rand,
+			threshold:        cb.threshold,
+			softThreshold:    cb.softThreshold,
+			sheddingCurve:    cb.sheddingCurve,
+			halfOpenRequests: cb.halfOpenMinRequests,
+			openSampling:     cb.openSampling,
+			rampUp:           cb.rampUp,
+		}
+		cb.openSampled = cb.openSampling > 0
+	}
+	cb.fastPath = cb.canFastPath()
+	if !cb.resetFailuresConfigured || cb.ignoreIsolatedFailures {
+		// 按滑动窗口开启时，成功不应抹掉已经记录的失败；按失败率开启时失败率使用周期内的全部请求，
+		// 连续失败数仍需清零，否则它会变成失败总数，少量分散的失败就会达到threshold
+		cb.resetFailuresOnSuccess = cb.ignoreIsolatedFailures || cb.window == nil
+	}
+	return cb
+}
+
+// Name 返回熔断器的名称
+func (cb *CircuitBreaker) Name() string {
+	return cb.name
+}
+
+// Threshold 返回熔断器的阈值，即关闭状态下触发开启的失败数以及半开启状态下的探测请求数
+// 阈值最小为1：创建熔断器时传入0会使用SetDefaultThreshold设置的默认值，而默认值本身不能设置为0，
+// 因此不存在第一次失败就开启或永远不开启这种与0比较导致的行为
+func (cb *CircuitBreaker) Threshold() uint32 {
+	return cb.threshold
 }
 
+// State 返回熔断器当前的状态
+// 开启状态已经超过openInterval时会先将熔断器切换到半开启状态，因此读取状态可能触发状态切换
+// cb为nil时返回StateClosed
+func (cb *CircuitBreaker) State() uint32 {
+	if cb == nil {
+		return StateClosed
+	}
+	state, _ := cb.refreshState(cb.now())
+	return state
+}
+
+// Peek 返回熔断器当前保存的状态，不会触发任何状态切换
+// 开启状态已经超过openInterval但还没有请求到来时，Peek仍然返回StateOpen，适用于监控采集等只读场景
+func (cb *CircuitBreaker) Peek() uint32 {
+	return atomic.LoadUint32(&cb.state)
+}
+
+// Allowable 返回此刻到来的请求是否会被放行，综合考虑是否已经Shutdown、当前状态、半开启状态下剩余的探测名额、
+// WithMaxConcurrency的并发名额以及放行策略，不占用名额也不增加任何统计数据，适用于负载均衡的健康检查等场景
+// 与State相同，开启状态已经超过openInterval时会先切换到半开启状态
+// 默认放行策略按概率放行时(WithSoftThreshold、WithRampUp、WithOpenSampling)不做随机判断，也不消耗随机数，
+// 放行概率不低于一半时返回true；自定义的AdmissionPolicy按原样调用，结果是否确定取决于策略本身
+func (cb *CircuitBreaker) Allowable() bool {
+	if cb.IsShutdown() {
+		return false
+	}
+	if cb.maxConcurrency > 0 && cb.InFlight() >= cb.maxConcurrency {
+		return false
+	}
+	state, _ := cb.refreshState(cb.now())
+	counts := cb.s.counts()
+	if policy, ok := cb.policy.(*defaultAdmissionPolicy); ok {
+		return policy.admitChance(state, counts) >= 0.5
+	}
+	switch state {
+	case StateOpen:
+		return cb.policy.AdmitOpen(counts)
+	case StateHalfOpen:
+		return cb.policy.AdmitHalfOpen(counts)
+	default:
+		return cb.policy.AdmitClosed(counts)
+	}
+}
+
+// Counts 返回熔断器当前周期的统计数据，不会触发状态切换
+func (cb *CircuitBreaker) Counts() Counts {
+	return cb.snapshot().counts
+}
+
+// FailedProbes 返回自上一次关闭以来半开启状态恢复失败(探测请求失败或超时)的次数，熔断器关闭时清零
+func (cb *CircuitBreaker) FailedProbes() uint32 {
+	return atomic.LoadUint32(&cb.failedProbes)
+}
+
+// Reset 将熔断器强制切换到关闭状态并清空统计数据，正在执行的请求的结果会被丢弃
+// StateDurations累计的时间同样从Reset开始重新计算
+func (cb *CircuitBreaker) Reset() {
+	now := cb.now()
+	for {
+		state := atomic.LoadUint32(&cb.state)
+		if state == StateClosed {
+			cb.newCycle(StateClosed, now)
+			cb.dwell.reset(now)
+			return
+		}
+		if cb.switchState(state, StateClosed, now, ReasonManual) {
+			cb.dwell.reset(now)
+			return
+		}
+	}
+}
+
+// Trip 将熔断器强制切换到开启状态，状态切换的原因为ReasonManual，之后与失败达到阈值时一样经过开启的时间周期后切换到半开启状态
+// 返回是否由这次调用开启了熔断器，熔断器已经处于开启状态时不做任何操作并返回false，正在执行的请求的结果会被丢弃
+// Trip与失败达到阈值等自动开启同时发生时，两者通过同一次状态的比较交换竞争，先完成的一方开启熔断器并决定开启的原因和失效时间，
+// 统计数据只清空一次；另一方不再做任何操作，因此Trip返回false时OpenCause返回的是自动开启的原因
+func (cb *CircuitBreaker) Trip() bool {
+	now := cb.now()
+	for {
+		state := atomic.LoadUint32(&cb.state)
+		if state == StateOpen {
+			return false
+		}
+		if cb.switchState(state, StateOpen, now, ReasonManual) {
+			return true
+		}
+	}
+}
+
+// HalfOpen 将熔断器强制切换到半开启状态，状态切换的原因为ReasonManual，不必等待开启的时间周期结束就可以立即放行探测请求
+// 与其它状态切换一样清空统计数据并进入新的周期，正在执行的请求的结果会被丢弃；开启状态的失效时间被清零，已经失败的探测次数保留，
+// 探测再次失败时仍然按WithFailedProbeBackoff退避。返回是否由这次调用切换了状态，已经处于半开启状态时不做任何操作并返回false
+// 主要用于运维工具和测试恢复过程，正常情况下应由熔断器自己在开启的时间周期结束后切换到半开启状态
+func (cb *CircuitBreaker) HalfOpen() bool {
+	now := cb.now()
+	for {
+		state := atomic.LoadUint32(&cb.state)
+		if state == StateHalfOpen {
+			return false
+		}
+		if cb.switchState(state, StateHalfOpen, now, ReasonManual) {
+			return true
+		}
+	}
+}
+
+// OpenCause 返回熔断器处于开启状态的原因，熔断器不处于开启状态时返回CauseNone
+// 与Peek相同，不会触发状态切换
+func (cb *CircuitBreaker) OpenCause() OpenCause {
+	if atomic.LoadUint32(&cb.state) != StateOpen {
+		return CauseNone
+	}
+	return OpenCause(atomic.LoadUint32(&cb.openCause))
+}
+
+// ResetCounts 清空熔断器当前周期的统计数据(包括滑动窗口)并进入新的周期，正在执行的请求的结果会被丢弃
+// 与Reset不同，ResetCounts不改变熔断器的状态，开启状态的失效时间保持不变；半开启状态下已经占用的探测名额被归还
+// 适用于配置变更或已知的短暂故障之后重新开始统计
+func (cb *CircuitBreaker) ResetCounts() {
+	cb.SwapCounts()
+}
+
+// SwapCounts 与ResetCounts相同，同时返回清空之前的统计数据，用于定期上报每个上报周期内的增量
+// 每一项数据的读取和清空是原子的，不会出现先读取再清空之间的请求被遗漏或重复上报。
+// SwapCounts之前放行、之后才结束的请求的结果被丢弃，不会计入之后的统计
+func (cb *CircuitBreaker) SwapCounts() Counts {
+	for {
+		cycle := atomic.LoadUint32(&cb.cycle)
+		if atomic.CompareAndSwapUint32(&cb.cycle, cycle, cycle+1) {
+			counts := cb.clearCounts()
+			cb.watchers.notify()
+			return counts
+		}
+	}
+}
+
+// Execute 经过熔断器的放行判断后执行f，f返回的bool表示请求是否成功，请求被拒绝时返回对应的错误
+// cb为nil时不做任何保护，直接执行f并返回nil，便于通过开关控制是否启用熔断器
 func (cb *CircuitBreaker) Execute(f func() bool) error {
-	cycle, err := cb.beforeExecute()
+	if cb == nil {
+		f()
+		return nil
+	}
+	if cb.fastPath {
+		if cycle, ok := cb.admitFast(); ok {
+			success, ignored := cb.invoke(f)
+			if ignored {
+				cb.cancel(cycle)
+				return nil
+			}
+			if !success || !cb.succeedFast(cycle) {
+				cb.afterExecute(cycle, success, cb.now())
+			}
+			return cb.callError(success)
+		}
+	}
+	cycle, err := cb.beforeExecute(cb.now())
+	if err != nil {
+		return err
+	}
+	defer cb.leaveConcurrency()
+	start := cb.slowStart()
+	success, ignored := cb.invoke(f)
+	if ignored {
+		cb.cancel(cycle)
+		return nil
+	}
+	cb.afterExecute(cycle, success, cb.now())
+	cb.observeLatency(cycle, start, cb.now(), success)
+	return cb.callError(success)
+}
+
+// ExecuteAt 与Execute相同，但熔断器在执行f前后都以now作为当前时间
+// 用于在测试中精确控制每次请求的时间，生产代码应使用Execute
+func (cb *CircuitBreaker) ExecuteAt(now time.Time, f func() bool) error {
+	cycle, err := cb.beforeExecute(cb.unix(now))
+	if err != nil {
+		return err
+	}
+	defer cb.leaveConcurrency()
+	start := cb.slowStart()
+	success, ignored := cb.invoke(f)
+	if ignored {
+		cb.cancel(cycle)
+		return nil
+	}
+	cb.afterExecute(cycle, success, cb.unix(now))
+	cb.observeLatency(cycle, start, cb.unix(now), success)
+	return cb.callError(success)
+}
+
+// ExecuteResult 与Execute相同，但f额外返回一个error
+// 默认由f返回的bool决定本次请求在熔断器统计中是成功还是失败；配置了WithOutcomeFunc时改为由配置的函数判断，
+// result为f返回的bool，返回OutcomeIgnore时不计入统计并归还占用的名额。error在请求被执行时原样返回给调用方
+// 请求被熔断器拒绝时返回ErrOpenState或ErrTooManyRequests，f不会被执行
+func (cb *CircuitBreaker) ExecuteResult(f func() (bool, error)) error {
+	cycle, err := cb.beforeExecute(cb.now())
+	if err != nil {
+		return err
+	}
+	defer cb.leaveConcurrency()
+	start := cb.slowStart()
+	ok, err := f()
+	outcome := OutcomeFailure
+	if cb.outcome != nil {
+		outcome = cb.outcome(ok, err)
+	} else if ok {
+		outcome = OutcomeSuccess
+	}
+	if outcome == OutcomeIgnore {
+		cb.cancel(cycle)
+		return err
+	}
+	success := outcome == OutcomeSuccess
+	if !success {
+		cb.recordError(err)
+	}
+	cb.afterExecute(cycle, success, cb.now())
+	cb.observeLatency(cycle, start, cb.now(), success)
+	return err
+}
+
+// ExecuteTimed 与Execute相同，额外返回按熔断器的时钟(参考WithClock)测量的f的执行耗时
+// 请求被熔断器拒绝时返回0和对应的错误
+func (cb *CircuitBreaker) ExecuteTimed(f func() bool) (time.Duration, error) {
+	cycle, err := cb.beforeExecute(cb.now())
+	if err != nil {
+		return 0, err
+	}
+	defer cb.leaveConcurrency()
+	start := cb.clock()
+	success, ignored := cb.invoke(f)
+	end := cb.clock()
+	if ignored {
+		cb.cancel(cycle)
+		return end.Sub(start), nil
+	}
+	cb.afterExecute(cycle, success, cb.now())
+	if cb.timed() {
+		cb.observeLatency(cycle, start, cb.now(), success)
+	}
+	return end.Sub(start), cb.callError(success)
+}
+
+// ExecuteN 与Execute相同，但f的结果按权重n计入统计，适用于f内部包含n个子操作的场景，例如一批100行的写入整体失败
+// 相当于连续记录n次相同的结果：失败数和连续失败数增加n，因此关闭状态下权重不小于threshold的一次失败会直接开启熔断器；
+// 半开启状态下一次失败照常重新开启，权重不小于threshold的一次成功可以直接关闭熔断器。请求数只增加1，Observer只回调一次
+// n为0时与1相同
+func (cb *CircuitBreaker) ExecuteN(n uint32, f func() bool) error {
+	if n == 0 {
+		n = 1
+	}
+	cycle, err := cb.beforeExecute(cb.now())
 	if err != nil {
 		return err
 	}
-	cb.afterExecute(cycle, f())
-	return nil
+	defer cb.leaveConcurrency()
+	start := cb.slowStart()
+	success, ignored := cb.invoke(f)
+	if ignored {
+		cb.cancel(cycle)
+		return nil
+	}
+	cb.afterExecuteN(cycle, success, cb.now(), n)
+	cb.observeLatency(cycle, start, cb.now(), success)
+	return cb.callError(success)
+}
+
+// invoke 执行f，配置了WithErrorPredicate时在f返回false后立即查询捕获的错误，错误不视为失败时ignored为true
+func (cb *CircuitBreaker) invoke(f func() bool) (success, ignored bool) {
+	success = f()
+	if !success && cb.captureError != nil {
+		err := cb.captureError()
+		if err != nil && !cb.isFailure(err) {
+			return false, true
+		}
+		cb.recordError(err)
+	}
+	return success, false
+}
+
+// callError 返回放行的请求执行完成后Execute等方法返回的错误
+// 默认返回nil，配置了WithCallFailedError时请求失败返回配置的错误
+func (cb *CircuitBreaker) callError(success bool) error {
+	if success {
+		return nil
+	}
+	return cb.callFailedError
+}
+
+// ExecuteAsync 在新的协程中通过Execute执行f，返回的通道会收到唯一的结果(nil、ErrOpenState等)后关闭
+// 放行判断同样在新的协程中进行，因此调用ExecuteAsync本身不会被拒绝
+func (cb *CircuitBreaker) ExecuteAsync(f func() bool) <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		result <- cb.Execute(f)
+		close(result)
+	}()
+	return result
 }
 
-func (cb *CircuitBreaker) beforeExecute() (uint32, error) {
-	now := time.Now().Unix()
+// ExecuteBypass 无论熔断器处于什么状态都执行f，返回f的结果
+// f的结果仍会计入熔断器的统计，开启状态下连续成功达到threshold时熔断器提前切换到半开启状态
+// 仅用于管理、健康检查等受信任的请求，普通请求应使用Execute。熔断器已经关停时不执行f，返回ErrShutdown
+func (cb *CircuitBreaker) ExecuteBypass(f func() bool) (bool, error) {
+	if cb.IsShutdown() {
+		return false, ErrShutdown
+	}
+	_, cycle := cb.refreshState(cb.now())
+	success := f()
+	cb.complete(cycle, success, cb.now(), 1, true)
+	return success, nil
+}
+
+// RecordSuccess 记录一次在熔断器之外执行的成功请求，与Execute中请求成功时的统计和状态切换完全相同，但不经过放行判断
+// 适用于异步回调等无法用Execute包裹的场景
+func (cb *CircuitBreaker) RecordSuccess() {
+	cb.record(true)
+}
+
+// RecordFailure 记录一次在熔断器之外执行的失败请求，参考RecordSuccess
+func (cb *CircuitBreaker) RecordFailure() {
+	cb.record(false)
+}
+
+// Warm 用近期的历史数据(例如来自其它实例或共享存储)预热关闭状态下的统计数据，
+// 依次记录successes次成功和failures次失败，配置了滑动窗口时同样计入窗口，失败数达到阈值时熔断器开启
+// 只在关闭状态下生效，可以在请求处理过程中安全调用，期间熔断器状态发生变化时停止预热
+func (cb *CircuitBreaker) Warm(successes, failures uint32) {
+	now := cb.now()
 	state, cycle := cb.refreshState(now)
-	if state == StateOpen {
-		return cycle, ErrOpenState
-	} else if state == StateHalfOpen && cb.s.requests >= cb.threshold {
-		return cycle, ErrTooManyRequests
+	if state != StateClosed {
+		return
+	}
+	if successes > 0 {
+		cb.onSuccess(StateClosed, now, successes)
+	}
+	if failures > 0 && atomic.LoadUint32(&cb.cycle) == cycle {
+		cb.onFailure(StateClosed, now, failures)
 	}
-	cb.s.request()
-	return cycle, nil
 }
 
-func (cb *CircuitBreaker) afterExecute(cycle uint32, success bool) {
-	now := time.Now().Unix()
-	state, newCycle := cb.refreshState(now)
-	if cycle != newCycle { // 其它请求导致熔断器状态发生变化，不做后续操作
+func (cb *CircuitBreaker) record(success bool) {
+	now := cb.now()
+	_, cycle := cb.refreshState(now)
+	cb.complete(cycle, success, now, 1, false)
+}
+
+// beforeExecute 进行放行判断，放行时返回放行时的周期
+// 放行后调用方需要在请求结束时调用leaveConcurrency归还并发名额
+func (cb *CircuitBreaker) beforeExecute(now int64) (uint32, error) {
+	_, cycle, err := cb.acquire(now)
+	return cycle, err
+}
+
+// acquire 与beforeExecute相同，额外返回放行判断时熔断器的状态
+func (cb *CircuitBreaker) acquire(now int64) (state, cycle uint32, err error) {
+	if cb.IsShutdown() {
+		return atomic.LoadUint32(&cb.state), atomic.LoadUint32(&cb.cycle), ErrShutdown
+	}
+	if !cb.enterConcurrency() {
+		state, cycle = cb.refreshState(now)
+		err = ErrConcurrencyLimit
+	} else {
+		state, cycle, err = cb.admit(now)
+		if err == ErrTooManyRequests && cb.halfOpenQueue > 0 {
+			state, cycle, err = cb.queueProbe()
+		}
+		if err != nil {
+			cb.leaveConcurrency()
+		}
+	}
+	if err != nil {
+		if err == ErrTooManyRequests {
+			cb.s.reject()
+		}
+		atomic.AddUint64(&cb.totalRejections, 1)
+		if cb.observer != nil {
+			cb.observer.Rejected(cb.name, state, err)
+		}
+		if cb.onRejectSample != nil && cb.sampleReject() {
+			cb.onRejectSample()
+		}
+		return state, cycle, err
+	}
+	return state, cycle, nil
+}
+
+// admit 根据当前状态和放行策略判断是否放行请求，放行时增加请求数
+func (cb *CircuitBreaker) admit(now int64) (state, cycle uint32, err error) {
+	state, cycle = cb.refreshState(now)
+	if cb.window != nil && state == StateClosed {
+		cb.window.aggregate(now)
+	}
+	counts := cb.s.counts()
+	switch state {
+	case StateOpen:
+		if !cb.policy.AdmitOpen(counts) {
+			return state, cycle, ErrOpenState
+		}
+	case StateHalfOpen:
+		if !cb.policy.AdmitHalfOpen(counts) {
+			return state, cycle, ErrTooManyRequests
+		}
+	default:
+		if !cb.policy.AdmitClosed(counts) {
+			return state, cycle, ErrShedding
+		}
+	}
+	if cb.s.request() == 1 && state == StateHalfOpen {
+		if cb.probeTimeout > 0 {
+			atomic.CompareAndSwapInt64(&cb.probeStart, 0, now)
+		}
+		if cb.staleProbeReset > 0 {
+			atomic.CompareAndSwapInt64(&cb.lastProbeResolved, 0, now)
+		}
+		if cb.onProbe != nil {
+			// 探测名额被归还后请求数可能再次从1开始，每个半开启周期只回调一次
+			if probed := atomic.LoadUint32(&cb.probeCycle); probed != cycle && atomic.CompareAndSwapUint32(&cb.probeCycle, probed, cycle) {
+				cb.onProbe()
+			}
+		}
+	}
+	return state, cycle, nil
+}
+
+// queueProbe 半开启状态下探测名额已满时，最多等待halfOpenQueue直到有名额释放或状态发生变化
+func (cb *CircuitBreaker) queueProbe() (state, cycle uint32, err error) {
+	ch, stop := cb.watchers.watch()
+	defer stop()
+	timer := time.NewTimer(cb.halfOpenQueue)
+	defer timer.Stop()
+	for {
+		// 订阅之后重新判断一次，避免错过订阅之前发生的变化
+		state, cycle, err = cb.admit(cb.now())
+		if err != ErrTooManyRequests {
+			return state, cycle, err
+		}
+		select {
+		case <-ch:
+		case <-timer.C:
+			return state, cycle, err
+		}
+	}
+}
+
+// sampleReject 是否抽中当前被拒绝的请求，第n个被拒绝的请求使累计的抽样数n*rejectSampleRate跨过整数时抽中，
+// 抽中的比例严格等于rejectSampleRate
+func (cb *CircuitBreaker) sampleReject() bool {
+	n := atomic.AddUint64(&cb.rejectSamples, 1)
+	return uint64(float64(n)*cb.rejectSampleRate) > uint64(float64(n-1)*cb.rejectSampleRate)
+}
+
+// release 归还一次已经放行的请求占用的名额
+func (cb *CircuitBreaker) release() {
+	cb.s.unrequest()
+	if cb.halfOpenQueue > 0 {
+		cb.watchers.notify()
+	}
+}
+
+// cancel 撤销beforeExecute放行的请求，释放半开启状态下占用的探测名额
+// 熔断器状态已经发生变化时不做任何操作
+func (cb *CircuitBreaker) cancel(cycle uint32) {
+	if atomic.LoadUint32(&cb.cycle) == cycle {
+		cb.release()
+	}
+}
+
+func (cb *CircuitBreaker) afterExecute(cycle uint32, success bool, now int64) {
+	cb.afterExecuteN(cycle, success, now, 1)
+}
+
+// afterExecuteN 与afterExecute相同，但请求的结果按weight次计入统计和累计数据，各项统计一次增加weight，
+// 状态切换的条件只判断一次，Observer只回调一次
+func (cb *CircuitBreaker) afterExecuteN(cycle uint32, success bool, now int64, weight uint32) {
+	cb.complete(cycle, success, now, weight, cb.openSampled)
+}
+
+// complete 记录请求的结果，probe表示开启状态下的成功是否计入提前恢复，
+// 只有ExecuteBypass和WithOpenSampling抽中的请求是探测请求，自定义放行策略放行的请求和RecordSuccess只计入成功数
+func (cb *CircuitBreaker) complete(cycle uint32, success bool, now int64, weight uint32, probe bool) {
+	if cb.tap != nil {
+		success = cb.tap(success)
+	}
+	if !success && cb.countFailure != nil && !cb.countFailure() {
+		// 不计入的失败与没有执行过一样，归还占用的名额
+		cb.cancel(cycle)
 		return
 	}
+	state, newCycle := cb.refreshState(now)
 	if success {
-		cb.onSuccess(state, now)
+		atomic.AddUint64(&cb.totalSuccesses, uint64(weight))
 	} else {
-		cb.onFailure(state, now)
+		atomic.AddUint64(&cb.totalFailures, uint64(weight))
+	}
+	if cb.observer != nil {
+		if success {
+			cb.observer.CallSucceeded(cb.name, state)
+		} else {
+			cb.observer.CallFailed(cb.name, state)
+		}
+	}
+	if cycle != newCycle { // 其它请求导致熔断器状态发生变化，不做后续操作
+		if success && state == StateOpen && newCycle == cycle+1 && cb.lateSuccessStep > 0 && cb.OpenCause() != CauseManual {
+			// 熔断器刚刚重新开启，请求的成功结果迟到了，记为一次恢复的迹象
+			// 通过Trip手动开启时不记录，迟到的结果不应影响手动开启之后的周期
+			atomic.AddUint32(&cb.recoveryHints, 1)
+		}
+		return
+	}
+	if state == StateHalfOpen && cb.staleProbeReset > 0 {
+		atomic.StoreInt64(&cb.lastProbeResolved, now)
+	}
+	if state == StateClosed && weight == 1 && cb.observationSampled() {
+		cb.observeSampled(success, now)
+		return
+	}
+	switch {
+	case success && state == StateOpen && cb.strategy == nil:
+		cb.onOpenSuccess(now, probe, weight)
+	case success:
+		cb.onSuccess(state, now, weight)
+	default:
+		cb.onFailure(state, now, weight)
 	}
 }
 
-func (cb *CircuitBreaker) onSuccess(state uint32, now int64) {
+// onSuccess 记录n次成功并判断是否需要切换状态，n大于1时各项统计一次增加n，切换条件只判断一次
+func (cb *CircuitBreaker) onSuccess(state uint32, now int64, n uint32) {
+	if cb.strategy != nil {
+		cb.strategySuccess(state, now, n)
+		return
+	}
 	switch state {
 	case StateClosed:
-		cb.s.success()
+		if cb.cooldownCredit > 0 {
+			// 正常的流量证明下游已经稳定，逐渐收回额度
+			cb.useCredit(n)
+		}
+		if cb.ignoreIsolatedFailures && atomic.LoadUint32(&cb.s.continuousFailures) == 1 {
+			// 前一次失败是孤立的，从失败总数中撤销
+			atomic.AddUint32(&cb.s.failures, ^uint32(0))
+		}
+		cb.s.successN(cb.threshold, cb.resetFailuresOnSuccess, n)
+		if cb.window != nil {
+			cb.window.recordN(now, true, n)
+		}
+		if cb.shared != nil {
+			cb.shared.window.recordN(now, true, n)
+		}
+		if cb.volume != nil {
+			cb.volume.recordN(now, true, n)
+		}
 	case StateHalfOpen:
-		if cb.s.success() >= cb.threshold {
-			cb.switchState(StateHalfOpen, StateClosed, now)
+		if cb.healthCheck != nil && !cb.healthy(now) {
+			return
+		}
+		if !cb.spreadSuccess(now) {
+			// 距离上一次计入的成功太近，不计入统计，并归还占用的探测名额
+			cb.release()
+			return
+		}
+		if cb.successDecay > 0 {
+			cb.decaySuccesses(now)
+		}
+		successes := cb.s.successN(cb.threshold, true, n)
+		shardsRecovered := cb.shards == nil || cb.shards.success()
+		if cb.halfOpenSuccessRatio > 0 {
+			var volume bucket
+			if cb.volume != nil {
+				volume = cb.volume.recordN(now, true, n)
+			}
+			if shardsRecovered {
+				cb.settleHalfOpen(volume, now)
+			} else {
+				cb.release()
+			}
+			return
+		}
+		if successes >= cb.threshold {
+			if !shardsRecovered {
+				// 成功都来自少数几个分片，归还名额继续探测其它分片
+				cb.release()
+				return
+			}
+			cb.recover(now)
 		}
 	}
 }
 
-func (cb *CircuitBreaker) onFailure(state uint32, now int64) {
+// onOpenSuccess 记录开启状态下的n次成功，probe为true时计入连续成功，连续成功达到threshold时提前切换到半开启状态
+func (cb *CircuitBreaker) onOpenSuccess(now int64, probe bool, n uint32) {
+	if !probe {
+		atomic.AddUint32(&cb.s.successes, n)
+		return
+	}
+	if cb.s.successN(cb.threshold, true, n) >= cb.threshold {
+		cb.switchState(StateOpen, StateHalfOpen, now, ReasonOpenRecovered)
+	}
+}
+
+// onFailure 记录n次失败并判断是否需要切换状态，参考onSuccess
+func (cb *CircuitBreaker) onFailure(state uint32, now int64, n uint32) {
+	if cb.strategy != nil {
+		cb.strategyFailure(state, now, n)
+		return
+	}
 	switch state {
 	case StateClosed:
-		if cb.s.failure() >= cb.threshold {
-			cb.switchState(StateClosed, StateOpen, now)
+		if cb.cooldownCredit > 0 {
+			// 被额度抵消的失败只计入失败数，不计入连续失败和滑动窗口
+			credited := cb.useCredit(n)
+			atomic.AddUint32(&cb.s.failures, credited)
+			if n -= credited; n == 0 {
+				return
+			}
+		}
+		threshold := cb.threshold + cb.forgiveness(now)
+		limit := threshold
+		if cb.ignoreIsolatedFailures && limit < 2 {
+			limit = 2
+		}
+		before, failures := cb.s.failureN(limit, n)
+		if cb.ignoreIsolatedFailures {
+			switch {
+			case failures == 1:
+				// 单次失败可能是孤立的，确认是连续失败后再计入
+				return
+			case before == 1:
+				// 之前暂缓计入的失败一并计入
+				n++
+			}
+		}
+		var volume bucket
+		if cb.window != nil {
+			failures = cb.window.recordN(now, false, n).failures
+		}
+		if cb.shared != nil {
+			if shared := cb.shared.window.recordN(now, false, n).failures; shared > failures {
+				failures = shared
+			}
+		}
+		if cb.volume != nil {
+			volume = cb.volume.recordN(now, false, n)
+		}
+		if (failures >= threshold || cb.ratioExceeded(volume)) && !cb.inStartupGrace(now) {
+			cb.switchState(StateClosed, StateOpen, now, ReasonThreshold)
 		}
 	case StateHalfOpen:
-		cb.s.failure()
-		cb.switchState(StateHalfOpen, StateOpen, now)
+		cb.s.failureN(cb.threshold, n)
+		if cb.halfOpenSuccessRatio > 0 {
+			var volume bucket
+			if cb.volume != nil {
+				volume = cb.volume.recordN(now, false, n)
+			}
+			cb.settleHalfOpen(volume, now)
+			return
+		}
+		cb.switchState(StateHalfOpen, StateOpen, now, ReasonHalfOpenFailure)
 	case StateOpen:
-		cb.s.failure()
+		cb.s.failureN(cb.threshold, n)
 	}
 }
 
 func (cb *CircuitBreaker) refreshState(now int64) (state, cycle uint32) {
-	expire := cb.openExpire
-	if cb.state == StateOpen && expire < now {
+	// state、openExpire和cycle由switchState和newCycle通过CAS修改，这里同样需要原子地读取
+	expire := atomic.LoadInt64(&cb.openExpire)
+	state = atomic.LoadUint32(&cb.state)
+	if cb.strategy != nil {
+		cb.strategyRefresh(now)
+	} else if state == StateOpen && expire < now {
 		// 熔断器处于开启状态，并且已经经过了一个时间周期，状态切换为半开启状态
-		cb.switchState(StateOpen, StateHalfOpen, now)
+		cb.switchState(StateOpen, StateHalfOpen, now, ReasonIntervalElapsed)
+	} else if state == StateOpen && cb.maxOpenDuration > 0 && cb.maxOpenExpire() < now {
+		// 不论开启的时间周期被延长到多久，开启状态持续超过maxOpenDuration后强制切换为半开启状态
+		cb.switchState(StateOpen, StateHalfOpen, now, ReasonMaxOpenDuration)
+	} else if state == StateHalfOpen && cb.probeTimeout > 0 && cb.probeTimedOut(now) {
+		// 半开启状态下放行的探测请求超时未返回，视为失败
+		cb.s.failure(cb.threshold)
+		cb.switchState(StateHalfOpen, StateOpen, now, ReasonProbeTimeout)
+	} else if state == StateHalfOpen && cb.maxHalfOpenDuration > 0 && atomic.LoadInt64(&cb.stateSince)+cb.maxHalfOpenDuration < now {
+		// 流量稀少时半开启状态既积累不到足够的成功也等不到失败，强制做出决定
+		cb.switchState(StateHalfOpen, cb.maxHalfOpenTarget(), now, ReasonMaxHalfOpenDuration)
+	} else if state == StateHalfOpen && cb.confirmWindow > 0 && cb.confirmed(now) {
+		// 确认窗口内没有失败，关闭熔断器
+		cb.switchState(StateHalfOpen, StateClosed, now, ReasonHalfOpenRecovered)
+	} else if state == StateHalfOpen && cb.staleProbeReset > 0 {
+		// 放行的探测请求被调用方丢弃，既不成功也不失败，归还它们占用的名额使探测可以继续
+		cb.compactProbes(now)
+	} else if state == StateClosed && cb.shared != nil && !cb.inStartupGrace(now) && cb.sharedTripped(now) {
+		// 其他熔断器记录的失败使共享统计达到阈值
+		cb.switchState(StateClosed, StateOpen, now, ReasonThreshold)
+	}
+	if cb.onLimbo != nil && atomic.LoadUint32(&cb.state) == StateHalfOpen {
+		cb.detectLimbo(now)
 	}
 
-	return cb.state, cb.cycle
+	return atomic.LoadUint32(&cb.state), atomic.LoadUint32(&cb.cycle)
 }
 
-func (cb *CircuitBreaker) switchState(oldState, newState uint32, now int64) {
+func (cb *CircuitBreaker) switchState(oldState, newState uint32, now int64, reason Reason) bool {
+	if cb.callbacks != nil {
+		// 回调按状态切换的顺序加入队列
+		cb.callbacks.order.Lock()
+		defer cb.callbacks.order.Unlock()
+	}
 	if atomic.CompareAndSwapUint32(&cb.state, oldState, newState) {
+		// 在newCycle清空统计数据之前读取，回调看到的是导致状态切换的统计数据
+		counts := cb.s.counts()
+		atomic.StoreInt64(&cb.stateSince, now)
+		if newState == StateOpen {
+			atomic.StoreUint32(&cb.openCause, uint32(reason.Cause()))
+		}
+		cb.dwell.leave(oldState, now)
+		if oldState == StateHalfOpen && newState == StateOpen {
+			atomic.AddUint32(&cb.failedProbes, 1)
+		}
+		if oldState == StateHalfOpen && newState == StateClosed {
+			atomic.StoreInt64(&cb.recoveredAt, now)
+			if cb.shared != nil {
+				// 探测证明下游已经恢复，清空共享统计，避免其他熔断器留下的失败使刚恢复的熔断器再次开启
+				cb.shared.window.clear()
+			}
+		}
+		if newState == StateClosed && cb.cooldownCredit > 0 {
+			atomic.StoreUint32(&cb.credit, cb.cooldownCredit)
+		}
+		cb.recordFlap(now)
 		cb.newCycle(newState, now)
+		if cb.onStateChange != nil || cb.observer != nil || cb.logTransition != nil {
+			cb.dispatch(func() { cb.stateChanged(oldState, newState, reason, counts) })
+		}
+		cb.watchers.notify()
+		return true
 	}
+	return false
 }
 
 func (cb *CircuitBreaker) newCycle(state uint32, now int64) {
-	if atomic.CompareAndSwapUint32(&cb.cycle, cb.cycle, cb.cycle+1) {
-		cb.s.clear()
-		expire := cb.openExpire
+	if cycle := atomic.LoadUint32(&cb.cycle); atomic.CompareAndSwapUint32(&cb.cycle, cycle, cycle+1) {
+		var interval int64
+		if state == StateOpen {
+			interval = cb.nextOpenInterval()
+		}
+		cb.clearCounts()
+		expire := atomic.LoadInt64(&cb.openExpire)
 		var newExpire int64
 		switch state {
 		case StateOpen:
-			newExpire = now + cb.openInterval
-		case StateHalfOpen, StateClosed:
+			newExpire = now + interval
+		case StateHalfOpen:
 			newExpire = 0
+		case StateClosed:
+			newExpire = 0
+			atomic.StoreUint32(&cb.recoveryHints, 0)
+			atomic.StoreUint32(&cb.failedProbes, 0)
 		}
 		atomic.CompareAndSwapInt64(&cb.openExpire, expire, newExpire)
 	}
 }
+
+// clearCounts 清空当前周期的统计数据并返回清空之前的数据，调用前应先递增cycle，使正在执行的请求的结果被丢弃
+func (cb *CircuitBreaker) clearCounts() Counts {
+	counts := cb.s.clear()
+	atomic.StoreInt64(&cb.probeStart, 0)
+	atomic.StoreInt64(&cb.lastProbeResolved, 0)
+	atomic.StoreInt64(&cb.confirmAt, 0)
+	atomic.StoreInt64(&cb.lastSpreadSuccess, 0)
+	atomic.StoreInt64(&cb.lastHalfOpenSuccess, 0)
+	if cb.window != nil {
+		cb.window.clear()
+	}
+	if cb.volume != nil {
+		cb.volume.clear()
+	}
+	if cb.shards != nil {
+		cb.shards.clear()
+	}
+	return counts
+}
+
+// nextOpenInterval 根据当前周期的统计数据计算下一次开启的时间周期，并消耗已经记录的恢复迹象
+func (cb *CircuitBreaker) nextOpenInterval() int64 {
+	interval := cb.openInterval
+	if cb.saturated() {
+		interval *= cb.saturationFactor
+	}
+	if cb.probeBackoffFactor > 1 {
+		interval = cb.probeBackoff(interval)
+	}
+	if cb.lateSuccessStep > 0 {
+		hints := atomic.SwapUint32(&cb.recoveryHints, 0)
+		interval -= int64(hints) * cb.lateSuccessStep
+		if interval < 1 {
+			interval = 1
+		}
+	}
+	return interval
+}
+
+// probeBackoff 按恢复失败的次数逐次延长开启的时间周期，不超过probeBackoffMax
+func (cb *CircuitBreaker) probeBackoff(interval int64) int64 {
+	failed := atomic.LoadUint32(&cb.failedProbes)
+	for i := uint32(0); i < failed; i++ {
+		if interval > math.MaxInt64/cb.probeBackoffFactor {
+			interval = math.MaxInt64
+			break
+		}
+		interval *= cb.probeBackoffFactor
+	}
+	if cb.probeBackoffMax > 0 && interval > cb.probeBackoffMax {
+		interval = cb.probeBackoffMax
+	}
+	return interval
+}
+
+// saturated 半开启状态下被拒绝的请求占比是否达到saturationRatio
+func (cb *CircuitBreaker) saturated() bool {
+	if cb.saturationRatio <= 0 {
+		return false
+	}
+	rejections := atomic.LoadUint32(&cb.s.rejections)
+	if rejections == 0 {
+		return false
+	}
+	requests := atomic.LoadUint32(&cb.s.requests)
+	return float64(rejections)/float64(rejections+requests) >= cb.saturationRatio
+}
+
+// maxOpenExpire 配置了maxOpenDuration时开启状态最晚的失效时间
+func (cb *CircuitBreaker) maxOpenExpire() int64 {
+	return atomic.LoadInt64(&cb.stateSince) + cb.maxOpenDuration
+}
+
+// maxHalfOpenTarget 半开启状态持续超过maxHalfOpenDuration后切换到的状态
+func (cb *CircuitBreaker) maxHalfOpenTarget() uint32 {
+	if cb.maxHalfOpenClose {
+		return StateClosed
+	}
+	return StateOpen
+}
+
+// inStartupGrace 是否处于创建熔断器之后的startupGrace内，按熔断器的时钟计算
+func (cb *CircuitBreaker) inStartupGrace(now int64) bool {
+	return cb.startupGrace > 0 && now < cb.unix(cb.epoch)+cb.startupGrace
+}
+
+// useCredit 消耗最多n个剩余额度，返回实际消耗的额度
+func (cb *CircuitBreaker) useCredit(n uint32) uint32 {
+	for {
+		credit := atomic.LoadUint32(&cb.credit)
+		used := n
+		if credit < used {
+			used = credit
+		}
+		if used == 0 || atomic.CompareAndSwapUint32(&cb.credit, credit, credit-used) {
+			return used
+		}
+	}
+}
+
+// forgiveness 关闭状态下开启熔断器所需的额外失败数，只在从半开启状态恢复之后的minClosedDuration内不为0
+func (cb *CircuitBreaker) forgiveness(now int64) uint32 {
+	if cb.minClosedDuration <= 0 {
+		return 0
+	}
+	recovered := atomic.LoadInt64(&cb.recoveredAt)
+	if recovered == 0 || now-recovered >= cb.minClosedDuration {
+		return 0
+	}
+	return cb.closedForgiveness
+}
+
+// decaySuccesses 半开启状态下距离上一次成功超过successDecay时清零连续成功数，并归还这些成功占用的探测名额
+func (cb *CircuitBreaker) decaySuccesses(now int64) {
+	last := atomic.SwapInt64(&cb.lastHalfOpenSuccess, now)
+	if last == 0 || now-last <= cb.successDecay {
+		return
+	}
+	stale := atomic.SwapUint32(&cb.s.continuousSuccesses, 0)
+	for i := uint32(0); i < stale; i++ {
+		cb.release()
+	}
+}
+
+// probeTimedOut 半开启状态下是否有探测请求从放行第一个探测请求开始超过probeTimeout仍未返回
+func (cb *CircuitBreaker) probeTimedOut(now int64) bool {
+	start := atomic.LoadInt64(&cb.probeStart)
+	if start == 0 || now-start < cb.probeTimeout {
+		return false
+	}
+	counts := cb.s.counts()
+	return counts.Requests > counts.Successes+counts.Failures
+}
+
+// compactProbes 半开启状态下超过staleProbeReset没有探测请求返回时，将请求数回退到已经返回的请求数
+// 被丢弃的请求之后如果仍然返回，其结果照常计入统计
+func (cb *CircuitBreaker) compactProbes(now int64) {
+	last := atomic.LoadInt64(&cb.lastProbeResolved)
+	if last == 0 || now-last < cb.staleProbeReset || !atomic.CompareAndSwapInt64(&cb.lastProbeResolved, last, now) {
+		return
+	}
+	counts := cb.s.counts()
+	resolved := counts.Successes + counts.Failures
+	for {
+		requests := atomic.LoadUint32(&cb.s.requests)
+		if requests <= resolved {
+			return
+		}
+		if atomic.CompareAndSwapUint32(&cb.s.requests, requests, resolved) {
+			if cb.halfOpenQueue > 0 {
+				cb.watchers.notify()
+			}
+			return
+		}
+	}
+}
+
+// spreadSuccess 半开启状态下的成功是否计入统计，配置了successSpread时与上一次计入的成功间隔不足successSpread的成功不计入
+func (cb *CircuitBreaker) spreadSuccess(now int64) bool {
+	if cb.successSpread <= 0 {
+		return true
+	}
+	for {
+		last := atomic.LoadInt64(&cb.lastSpreadSuccess)
+		if last != 0 && now-last < cb.successSpread {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&cb.lastSpreadSuccess, last, now) {
+			return true
+		}
+	}
+}
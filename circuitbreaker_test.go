@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -90,3 +95,1235 @@ func TestCircuitBreakerParallel(t *testing.T) {
 		}
 	}
 }
+
+func TestCircuitBreakerExecuteResult(t *testing.T) {
+	cb := NewCircuitBreaker(60, 3)
+	errBusiness := errors.New("business error")
+	// 业务错误但不计为失败
+	for i := 0; i < 5; i++ {
+		err := cb.ExecuteResult(func() (bool, error) { return true, errBusiness })
+		if err != errBusiness {
+			t.Fatal(err)
+		}
+	}
+	// 计为失败，错误原样返回
+	for i := 0; i < 3; i++ {
+		err := cb.ExecuteResult(func() (bool, error) { return false, errBusiness })
+		if err != errBusiness {
+			t.Fatal(err)
+		}
+	}
+	// open
+	executed := false
+	err := cb.ExecuteResult(func() (bool, error) {
+		executed = true
+		return true, nil
+	})
+	if err != ErrOpenState || executed {
+		t.Fatal(err, executed)
+	}
+}
+
+func TestCircuitBreakerExecuteResultOutcomeFunc(t *testing.T) {
+	errCanceled := errors.New("canceled")
+	errTransient := errors.New("transient")
+	cb := NewCircuitBreaker(60, 1, WithOutcomeFunc(func(result interface{}, err error) Outcome {
+		switch err {
+		case errCanceled:
+			return OutcomeIgnore
+		case errTransient:
+			return OutcomeSuccess
+		}
+		if result == true {
+			return OutcomeSuccess
+		}
+		return OutcomeFailure
+	}))
+	// 配置了WithOutcomeFunc时由配置的函数判断，而不是f返回的bool
+	if err := cb.ExecuteResult(func() (bool, error) { return false, errTransient }); err != errTransient {
+		t.Fatal(err)
+	}
+	if err := cb.ExecuteResult(func() (bool, error) { return false, errCanceled }); err != errCanceled {
+		t.Fatal(err)
+	}
+	if c := cb.Counts(); c.Requests != 1 || c.Successes != 1 || c.Failures != 0 {
+		t.Fatal(c)
+	}
+	RequireState(t, cb, StateClosed)
+	if err := cb.ExecuteResult(func() (bool, error) { return false, nil }); err != nil {
+		t.Fatal(err)
+	}
+	RequireState(t, cb, StateOpen)
+}
+
+func TestCircuitBreakerSoftThreshold(t *testing.T) {
+	cb := NewCircuitBreaker(60, 10, WithSoftThreshold(2, nil))
+	// 未达到soft threshold时不拒绝
+	_ = fail(cb)
+	for i := 0; i < 1000; i++ {
+		if _, err := cb.beforeExecute(0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		cb.onFailure(StateClosed, 0, 1)
+	}
+	// 连续失败5次，拒绝概率为(5-2+1)/(10-2+1)
+	const total = 20000
+	rejected := 0
+	for i := 0; i < total; i++ {
+		_, err := cb.beforeExecute(0)
+		if err == ErrShedding {
+			rejected++
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := LinearShedding(5, 2, 10)
+	got := float64(rejected) / total
+	if math.Abs(got-want) > 0.03 {
+		t.Fatalf("shedding ratio %f, want about %f", got, want)
+	}
+
+	// 自定义曲线
+	cb = NewCircuitBreaker(60, 10, WithSoftThreshold(1, func(failures, soft, hard uint32) float64 { return 1 }))
+	_ = fail(cb)
+	if err := success(cb); err != ErrShedding {
+		t.Fatal(err)
+	}
+}
+
+func TestCircuitBreakerExecuteAt(t *testing.T) {
+	cb := NewCircuitBreaker(10, 3)
+	now := time.Unix(1000, 0)
+	ok := func() bool { return true }
+	ko := func() bool { return false }
+	// closed -> open
+	for i := 0; i < 3; i++ {
+		if err := cb.ExecuteAt(now, ko); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cb.state != StateOpen {
+		t.Fatal(cb.state)
+	}
+	if err := cb.ExecuteAt(now.Add(10*time.Second), ok); err != ErrOpenState {
+		t.Fatal(err)
+	}
+	// open -> half open -> open
+	if err := cb.ExecuteAt(now.Add(11*time.Second), ko); err != nil {
+		t.Fatal(err)
+	}
+	if cb.state != StateOpen {
+		t.Fatal(cb.state)
+	}
+	// open -> half open -> closed
+	now = now.Add(22 * time.Second)
+	for i := 0; i < 3; i++ {
+		if err := cb.ExecuteAt(now, ok); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cb.state != StateClosed {
+		t.Fatal(cb.state)
+	}
+}
+
+func TestCircuitBreakerExecuteTimed(t *testing.T) {
+	cb := NewCircuitBreaker(60, 1)
+	elapsed, err := cb.ExecuteTimed(func() bool {
+		time.Sleep(50 * time.Millisecond)
+		return false
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed < 50*time.Millisecond || elapsed > 500*time.Millisecond {
+		t.Fatal(elapsed)
+	}
+	// open
+	elapsed, err = cb.ExecuteTimed(func() bool { return true })
+	if err != ErrOpenState || elapsed != 0 {
+		t.Fatal(elapsed, err)
+	}
+}
+
+func TestCircuitBreakerHalfOpenSaturationBackoff(t *testing.T) {
+	cb := NewCircuitBreaker(10, 2, WithHalfOpenSaturationBackoff(0.5, 3))
+	now := int64(1000)
+	for i := 0; i < 2; i++ {
+		cycle, _ := cb.beforeExecute(now)
+		cb.afterExecute(cycle, false, now)
+	}
+	if cb.openExpire != now+10 {
+		t.Fatal(cb.openExpire)
+	}
+	// half open，探测请求未返回时大量请求被拒绝
+	now += 11
+	cycle, err := cb.beforeExecute(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cb.beforeExecute(now); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := cb.beforeExecute(now); err != ErrTooManyRequests {
+			t.Fatal(err)
+		}
+	}
+	cb.afterExecute(cycle, false, now)
+	if cb.state != StateOpen || cb.openExpire != now+30 {
+		t.Fatal(cb.state, cb.openExpire)
+	}
+	// 未饱和时使用正常的时间周期
+	now += 31
+	cycle, _ = cb.beforeExecute(now)
+	cb.afterExecute(cycle, false, now)
+	if cb.state != StateOpen || cb.openExpire != now+10 {
+		t.Fatal(cb.state, cb.openExpire)
+	}
+}
+
+func TestCircuitBreakerExecuteBypass(t *testing.T) {
+	cb := NewCircuitBreaker(60, 3)
+	for i := 0; i < 3; i++ {
+		_ = fail(cb)
+	}
+	// open
+	if err := success(cb); err != ErrOpenState {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		ok, err := cb.ExecuteBypass(func() bool { return true })
+		if !ok || err != nil {
+			t.Fatal(ok, err)
+		}
+	}
+	if cb.state != StateOpen {
+		t.Fatal(cb.state)
+	}
+	// 绕过熔断器的失败同样会被统计
+	ok, err := cb.ExecuteBypass(func() bool { return false })
+	if ok || err != nil || cb.s.continuousFailures != 1 {
+		t.Fatal(ok, err, cb.s.continuousFailures)
+	}
+	for i := 0; i < 3; i++ {
+		_, _ = cb.ExecuteBypass(func() bool { return true })
+	}
+	// half open
+	if cb.state != StateHalfOpen {
+		t.Fatal(cb.state)
+	}
+	for i := 0; i < 3; i++ {
+		if err := success(cb); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cb.state != StateClosed {
+		t.Fatal(cb.state)
+	}
+
+	// RecordSuccess记录的成功不计入开启状态下的提前恢复
+	cb = NewCircuitBreaker(60, 3)
+	DriveToOpen(cb)
+	for i := 0; i < 10; i++ {
+		cb.RecordSuccess()
+	}
+	RequireState(t, cb, StateOpen)
+
+	// 关停后不再执行f
+	cb.Shutdown()
+	ok, err = cb.ExecuteBypass(func() bool {
+		t.Fatal("executed after shutdown")
+		return true
+	})
+	if ok || err != ErrShutdown {
+		t.Fatal(ok, err)
+	}
+}
+
+func TestCircuitBreakerPeek(t *testing.T) {
+	cb := NewCircuitBreaker(60, 1)
+	_ = fail(cb)
+	if cb.Peek() != StateOpen || cb.State() != StateOpen {
+		t.Fatal(cb.Peek(), cb.State())
+	}
+	// 开启周期已经过去，Peek仍然返回开启状态，并且不会触发到半开启状态的切换
+	advance(cb, 61*time.Second)
+	cycle := atomic.LoadUint32(&cb.cycle)
+	if cb.Peek() != StateOpen {
+		t.Fatal(cb.Peek())
+	}
+	if state := atomic.LoadUint32(&cb.state); state != StateOpen || atomic.LoadUint32(&cb.cycle) != cycle {
+		t.Fatal(state, cb.cycle, cycle)
+	}
+	if cb.State() != StateHalfOpen || cb.Peek() != StateHalfOpen {
+		t.Fatal(cb.State(), cb.Peek())
+	}
+}
+
+func TestCircuitBreakerLateSuccessRecovery(t *testing.T) {
+	for _, step := range []int64{0, 3} {
+		var opts []Option
+		if step > 0 {
+			opts = append(opts, WithLateSuccessRecovery(step))
+		}
+		cb := NewCircuitBreaker(10, 2, opts...)
+		now := int64(1000)
+		for i := 0; i < 2; i++ {
+			cycle, _ := cb.beforeExecute(now)
+			cb.afterExecute(cycle, false, now)
+		}
+		// half open，慢请求的结果在熔断器重新开启后才返回
+		now += 11
+		slow, _ := cb.beforeExecute(now)
+		fast, _ := cb.beforeExecute(now)
+		cb.afterExecute(fast, false, now)
+		if cb.state != StateOpen || cb.openExpire != now+10 {
+			t.Fatal(cb.state, cb.openExpire)
+		}
+		cb.afterExecute(slow, true, now+1)
+		// 再次半开启后失败，默认丢弃迟到的结果
+		now += 11
+		cycle, _ := cb.beforeExecute(now)
+		cb.afterExecute(cycle, false, now)
+		if cb.state != StateOpen || cb.openExpire != now+10-step {
+			t.Fatal(step, cb.state, cb.openExpire-now)
+		}
+		// 恢复迹象只作用一次
+		now += 11
+		cycle, _ = cb.beforeExecute(now)
+		cb.afterExecute(cycle, false, now)
+		if cb.openExpire != now+10 {
+			t.Fatal(step, cb.openExpire-now)
+		}
+	}
+}
+
+func TestCircuitBreakerWithRand(t *testing.T) {
+	decisions := func(seed int64) []bool {
+		cb := NewCircuitBreaker(60, 10, WithSoftThreshold(2, nil), WithRand(rand.New(rand.NewSource(seed))))
+		for i := 0; i < 5; i++ {
+			cb.onFailure(StateClosed, 0, 1)
+		}
+		result := make([]bool, 1000)
+		for i := range result {
+			_, err := cb.beforeExecute(0)
+			result[i] = err == ErrShedding
+		}
+		return result
+	}
+	a, b := decisions(42), decisions(42)
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatal(i)
+		}
+	}
+}
+
+func TestCircuitBreakerRecord(t *testing.T) {
+	cb := NewCircuitBreaker(60, 3)
+	cb.RecordFailure()
+	cb.RecordFailure()
+	cb.RecordSuccess()
+	cb.RecordFailure()
+	cb.RecordFailure()
+	if cb.state != StateClosed || cb.s.requests != 0 {
+		t.Fatal(cb.state, cb.s.requests)
+	}
+	cb.RecordFailure()
+	if cb.state != StateOpen {
+		t.Fatal(cb.state)
+	}
+	if err := success(cb); err != ErrOpenState {
+		t.Fatal(err)
+	}
+}
+
+func TestCircuitBreakerProbeTimeout(t *testing.T) {
+	cb := NewCircuitBreaker(10, 2, WithProbeTimeout(5))
+	now := int64(1000)
+	for i := 0; i < 2; i++ {
+		cycle, _ := cb.beforeExecute(now)
+		cb.afterExecute(cycle, false, now)
+	}
+	// half open，一个探测请求卡住
+	now += 11
+	hanging, err := cb.beforeExecute(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cycle, _ := cb.beforeExecute(now + 1)
+	cb.afterExecute(cycle, true, now+1)
+	if _, err := cb.beforeExecute(now + 4); err != ErrTooManyRequests {
+		t.Fatal(err)
+	}
+	// 超时后视为失败，重新开启
+	if _, err := cb.beforeExecute(now + 5); err != ErrOpenState {
+		t.Fatal(err)
+	}
+	// 恢复流程继续进行
+	now += 16
+	for i := 0; i < 2; i++ {
+		cycle, err := cb.beforeExecute(now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cb.afterExecute(cycle, true, now)
+	}
+	cb.afterExecute(hanging, true, now)
+	if cb.state != StateClosed {
+		t.Fatal(cb.state)
+	}
+}
+
+func TestCircuitBreakerStaleProbeReset(t *testing.T) {
+	cb := NewCircuitBreaker(10, 2, WithStaleProbeReset(5*time.Second))
+	now := int64(1000)
+	for i := 0; i < 2; i++ {
+		cycle, _ := cb.beforeExecute(now)
+		cb.afterExecute(cycle, false, now)
+	}
+	// half open，一个探测请求成功，另一个被调用方丢弃
+	now += 11
+	cycle, err := cb.beforeExecute(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cb.beforeExecute(now); err != nil {
+		t.Fatal(err)
+	}
+	cb.afterExecute(cycle, true, now+1)
+	if _, err := cb.beforeExecute(now + 5); err != ErrTooManyRequests {
+		t.Fatal(err)
+	}
+	// 最近一次探测请求返回之后超过5秒，归还被丢弃的请求占用的名额，不视为失败
+	cycle, err = cb.beforeExecute(now + 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cb.state != StateHalfOpen {
+		t.Fatal(cb.state)
+	}
+	cb.afterExecute(cycle, true, now+6)
+	if cb.state != StateClosed {
+		t.Fatal(cb.state)
+	}
+}
+
+func TestCircuitBreakerHalfOpenSuccessSpread(t *testing.T) {
+	cb := NewCircuitBreaker(10, 3, WithHalfOpenSuccessSpread(2))
+	now := time.Unix(1000, 0)
+	ok := func() bool { return true }
+	for i := 0; i < 3; i++ {
+		_ = cb.ExecuteAt(now, func() bool { return false })
+	}
+	// half open，同一时刻的大量重试只计入一次成功
+	now = now.Add(11 * time.Second)
+	for i := 0; i < 100; i++ {
+		if err := cb.ExecuteAt(now, ok); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cb.state != StateHalfOpen || cb.s.continuousSuccesses != 1 {
+		t.Fatal(cb.state, cb.s.continuousSuccesses)
+	}
+	now = now.Add(time.Second)
+	_ = cb.ExecuteAt(now, ok)
+	if cb.state != StateHalfOpen {
+		t.Fatal(cb.state)
+	}
+	for i := 0; i < 2; i++ {
+		now = now.Add(2 * time.Second)
+		_ = cb.ExecuteAt(now, ok)
+	}
+	if cb.state != StateClosed {
+		t.Fatal(cb.state)
+	}
+}
+
+func TestCircuitBreakerExecuteAsync(t *testing.T) {
+	cb := NewCircuitBreaker(60, 2)
+	for i := 0; i < 2; i++ {
+		if err := <-cb.ExecuteAsync(func() bool { return false }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// open
+	ch := cb.ExecuteAsync(func() bool { return true })
+	if err := <-ch; err != ErrOpenState {
+		t.Fatal(err)
+	}
+	if _, ok := <-ch; ok {
+		t.Fatal("channel should be closed")
+	}
+	// half open
+	atomic.StoreInt64(&cb.openExpire, cb.now()-1)
+	release := make(chan struct{})
+	first := cb.ExecuteAsync(func() bool {
+		<-release
+		return true
+	})
+	second := cb.ExecuteAsync(func() bool {
+		<-release
+		return true
+	})
+	for atomic.LoadUint32(&cb.s.requests) != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := <-cb.ExecuteAsync(func() bool { return true }); err != ErrTooManyRequests {
+		t.Fatal(err)
+	}
+	close(release)
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-second; err != nil {
+		t.Fatal(err)
+	}
+	if cb.State() != StateClosed {
+		t.Fatal(cb.State())
+	}
+}
+
+func TestCircuitBreakerReset(t *testing.T) {
+	var reasons []Reason
+	cb := NewCircuitBreaker(60, 2, WithOnStateChange(func(name string, from, to uint32, reason Reason, counts Counts) {
+		reasons = append(reasons, reason)
+	}))
+	_ = fail(cb)
+	cb.Reset()
+	if c := cb.Counts(); c.ContinuousFailures != 0 || c.Requests != 0 || cb.State() != StateClosed {
+		t.Fatal(c, cb.State())
+	}
+	_ = fail(cb)
+	_ = fail(cb)
+	if cb.State() != StateOpen {
+		t.Fatal(cb.State())
+	}
+	cb.Reset()
+	if cb.State() != StateClosed || cb.openExpire != 0 {
+		t.Fatal(cb.State(), cb.openExpire)
+	}
+	if err := success(cb); err != nil {
+		t.Fatal(err)
+	}
+	if len(reasons) != 2 || reasons[0] != ReasonThreshold || reasons[1] != ReasonManual {
+		t.Fatal(reasons)
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	var transitions []transition
+	cb := NewCircuitBreaker(60, 2, WithOnStateChange(func(name string, from, to uint32, reason Reason, counts Counts) {
+		transitions = append(transitions, transition{from, to, reason})
+	}))
+	DriveToOpen(cb)
+	cycle := cb.cycle
+	if !cb.HalfOpen() {
+		t.Fatal("not switched")
+	}
+	RequireState(t, cb, StateHalfOpen)
+	if cb.cycle != cycle+1 || cb.openExpire != 0 || cb.Counts() != (Counts{}) {
+		t.Fatal(cb.cycle, cb.openExpire, cb.Counts())
+	}
+	if transitions[len(transitions)-1] != (transition{StateOpen, StateHalfOpen, ReasonManual}) {
+		t.Fatal(transitions)
+	}
+	if cb.HalfOpen() {
+		t.Fatal("switched twice")
+	}
+	// 不必等待开启的时间周期，探测请求立即被放行
+	for i := 0; i < 2; i++ {
+		if err := success(cb); err != nil {
+			t.Fatal(err)
+		}
+	}
+	RequireState(t, cb, StateClosed)
+}
+
+func TestCircuitBreakerManualTransitionDropsInFlight(t *testing.T) {
+	cases := []struct {
+		name    string
+		setup   func(cb *CircuitBreaker)
+		force   func(cb *CircuitBreaker)
+		success bool
+		want    uint32
+	}{
+		{"reset while closed", func(cb *CircuitBreaker) { _ = fail(cb) }, (*CircuitBreaker).Reset, false, StateClosed},
+		{"reset while half-open", DriveToHalfOpen, (*CircuitBreaker).Reset, false, StateClosed},
+		{"trip", func(cb *CircuitBreaker) {}, func(cb *CircuitBreaker) { cb.Trip() }, true, StateOpen},
+		{"half-open from closed", func(cb *CircuitBreaker) {}, func(cb *CircuitBreaker) { cb.HalfOpen() }, false, StateHalfOpen},
+	}
+	for _, c := range cases {
+		cb := NewCircuitBreaker(60, 2, WithLateSuccessRecovery(10))
+		c.setup(cb)
+		cycle, err := cb.beforeExecute(cb.now())
+		if err != nil {
+			t.Fatal(c.name, err)
+		}
+		c.force(cb)
+		if cb.cycle == cycle {
+			t.Fatal(c.name, "cycle not bumped")
+		}
+		// 手动切换之前放行的请求在切换之后才返回，结果被丢弃
+		cb.afterExecute(cycle, c.success, cb.now())
+		RequireState(t, cb, c.want)
+		if counts := cb.Counts(); counts.Successes != 0 || counts.Failures != 0 || cb.recoveryHints != 0 {
+			t.Fatal(c.name, counts, cb.recoveryHints)
+		}
+	}
+}
+
+func TestCircuitBreakerWarm(t *testing.T) {
+	cb := NewCircuitBreaker(60, 5)
+	cb.Warm(100, 3)
+	if c := cb.Counts(); c.Successes != 100 || c.Failures != 3 || c.ContinuousFailures != 3 || c.Requests != 0 {
+		t.Fatal(c)
+	}
+	// 预热后只需要再失败两次
+	_ = fail(cb)
+	_ = fail(cb)
+	if cb.State() != StateOpen {
+		t.Fatal(cb.State())
+	}
+	// 开启状态下不生效
+	cb.Warm(10, 10)
+	if c := cb.Counts(); c.Successes != 0 || c.Failures != 0 {
+		t.Fatal(c)
+	}
+
+	// 计入滑动窗口
+	cb = NewCircuitBreaker(60, 5, WithBucketedWindow(10, 6))
+	cb.Warm(0, 4)
+	if b := cb.window.aggregate(cb.now()); b.failures != 4 {
+		t.Fatal(b)
+	}
+	cb.Warm(1, 1)
+	if cb.State() != StateOpen {
+		t.Fatal(cb.State())
+	}
+}
+
+func TestCircuitBreakerSaturatingCounts(t *testing.T) {
+	cb := NewCircuitBreaker(60, 3)
+	for i := 0; i < 100; i++ {
+		_ = success(cb)
+	}
+	if c := cb.Counts(); c.ContinuousSuccesses != 3 || c.Successes != 100 {
+		t.Fatal(c)
+	}
+
+	// 接近uint32上限时不会回绕
+	cb = NewCircuitBreaker(60, math.MaxUint32)
+	cb.s.continuousSuccesses = math.MaxUint32 - 2
+	for i := 0; i < 5; i++ {
+		_ = success(cb)
+		if cb.s.continuousSuccesses < math.MaxUint32-2 {
+			t.Fatal(cb.s.continuousSuccesses)
+		}
+	}
+	if cb.s.continuousSuccesses != math.MaxUint32 {
+		t.Fatal(cb.s.continuousSuccesses)
+	}
+	cb.s.continuousFailures = math.MaxUint32 - 1
+	_ = fail(cb)
+	if cb.State() != StateOpen {
+		t.Fatal(cb.State())
+	}
+}
+
+func TestCircuitBreakerCallFailedError(t *testing.T) {
+	cb := NewCircuitBreaker(60, 2, WithCallFailedError(nil))
+	if err := success(cb); err != nil {
+		t.Fatal(err)
+	}
+	if err := fail(cb); err != ErrCallFailed {
+		t.Fatal(err)
+	}
+	if _, err := cb.ExecuteTimed(func() bool { return false }); err != ErrCallFailed {
+		t.Fatal(err)
+	}
+	// 被拒绝时仍然返回对应的错误
+	if err := fail(cb); err != ErrOpenState {
+		t.Fatal(err)
+	}
+
+	errCustom := errors.New("custom")
+	cb = NewCircuitBreaker(60, 2, WithCallFailedError(errCustom))
+	if err := cb.ExecuteAt(time.Now(), func() bool { return false }); err != errCustom {
+		t.Fatal(err)
+	}
+	// 默认返回nil
+	cb = NewCircuitBreaker(60, 2)
+	if err := fail(cb); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCircuitBreakerOnProbe(t *testing.T) {
+	probes := 0
+	cb := NewCircuitBreaker(60, 2, WithOnProbe(func() { probes++ }))
+	// 切换到半开启状态本身不触发回调
+	DriveToHalfOpen(cb)
+	RequireState(t, cb, StateHalfOpen)
+	if probes != 0 {
+		t.Fatal(probes)
+	}
+	cycle, err := cb.beforeExecute(cb.now())
+	if err != nil || probes != 1 {
+		t.Fatal(err, probes)
+	}
+	// 归还名额后再次放行不重复回调
+	cb.cancel(cycle)
+	_ = success(cb)
+	if probes != 1 {
+		t.Fatal(probes)
+	}
+	// 重新开启后的下一个半开启周期再次回调
+	_ = fail(cb)
+	DriveToHalfOpen(cb)
+	_ = success(cb)
+	if probes != 2 {
+		t.Fatal(probes)
+	}
+}
+
+func TestCircuitBreakerFailedProbeBackoff(t *testing.T) {
+	cb := NewCircuitBreaker(10, 2, WithFailedProbeBackoff(2, 50))
+	DriveToOpen(cb)
+	if cb.openExpire-cb.now() != 10 || cb.FailedProbes() != 0 {
+		t.Fatal(cb.openExpire-cb.now(), cb.FailedProbes())
+	}
+	for _, want := range []int64{20, 40, 50, 50} {
+		advance(cb, time.Duration(cb.openExpire-cb.now()+1)*time.Second)
+		RequireState(t, cb, StateHalfOpen)
+		_ = fail(cb)
+		RequireState(t, cb, StateOpen)
+		if got := cb.openExpire - cb.now(); got != want {
+			t.Fatal(got, want)
+		}
+	}
+	if cb.FailedProbes() != 4 {
+		t.Fatal(cb.FailedProbes())
+	}
+	// 关闭后恢复为openInterval
+	advance(cb, time.Duration(cb.openExpire-cb.now()+1)*time.Second)
+	_ = success(cb)
+	_ = success(cb)
+	RequireState(t, cb, StateClosed)
+	if cb.FailedProbes() != 0 {
+		t.Fatal(cb.FailedProbes())
+	}
+	DriveToOpen(cb)
+	if cb.openExpire-cb.now() != 10 {
+		t.Fatal(cb.openExpire - cb.now())
+	}
+}
+
+func TestCircuitBreakerAllowable(t *testing.T) {
+	cb := NewCircuitBreaker(60, 2)
+	if !cb.Allowable() {
+		t.Fatal(cb.Describe())
+	}
+	DriveToOpen(cb)
+	if cb.Allowable() {
+		t.Fatal(cb.Describe())
+	}
+	DriveToHalfOpen(cb)
+	RequireState(t, cb, StateHalfOpen)
+	// 占满半开启状态的探测名额
+	for i := 0; i < 2; i++ {
+		if !cb.Allowable() {
+			t.Fatal(i, cb.Describe())
+		}
+		if _, err := cb.beforeExecute(cb.now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	requests := cb.Counts().Requests
+	if cb.Allowable() || cb.Counts().Requests != requests {
+		t.Fatal(cb.Describe())
+	}
+}
+
+func TestCircuitBreakerAllowableConcurrencyAndShutdown(t *testing.T) {
+	cb := NewCircuitBreaker(60, 2, WithMaxConcurrency(1))
+	release, err := cb.Reserve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 并发名额已满
+	if cb.Allowable() {
+		t.Fatal(cb.Describe())
+	}
+	release(true)
+	if !cb.Allowable() {
+		t.Fatal(cb.Describe())
+	}
+	cb.Shutdown()
+	if cb.Allowable() {
+		t.Fatal(cb.Describe())
+	}
+}
+
+// countingSource 记录随机数的使用次数
+type countingSource struct {
+	rand.Source
+	n int
+}
+
+func (s *countingSource) Int63() int64 {
+	s.n++
+	return s.Source.Int63()
+}
+
+func TestCircuitBreakerAllowableProbabilistic(t *testing.T) {
+	src := &countingSource{Source: rand.NewSource(1)}
+	cb := NewCircuitBreaker(60, 4, WithSoftThreshold(1, LinearShedding), WithOpenSampling(0.1), WithRampUp(0.2, 0.6), WithRand(rand.New(src)))
+	// 按概率放行时结果是确定的：放行概率不低于一半时返回true，并且不消耗放行策略的随机数
+	check := func(want bool) {
+		t.Helper()
+		n := src.n
+		for i := 0; i < 100; i++ {
+			if cb.Allowable() != want {
+				t.Fatal(i, cb.Describe())
+			}
+		}
+		if src.n != n {
+			t.Fatal("consumed random numbers", src.n-n)
+		}
+	}
+	cb.RecordFailure() // 拒绝概率1/4
+	check(true)
+	cb.RecordFailure()
+	cb.RecordFailure() // 拒绝概率3/4
+	check(false)
+	DriveToOpen(cb)
+	check(false)
+	DriveToHalfOpen(cb)
+	check(false)
+	atomic.StoreUint32(&cb.s.continuousSuccesses, 1)
+	check(true)
+}
+
+func TestCircuitBreakerMaxOpenDuration(t *testing.T) {
+	var reasons []Reason
+	cb := NewCircuitBreaker(10, 1,
+		WithFailedProbeBackoff(1000, 0),
+		WithMaxOpenDuration(30*time.Second),
+		WithOnStateChange(func(name string, from, to uint32, reason Reason, counts Counts) {
+			reasons = append(reasons, reason)
+		}))
+	DriveToHalfOpen(cb)
+	_ = fail(cb)
+	RequireState(t, cb, StateOpen)
+	if cb.openExpire-cb.now() != 10000 {
+		t.Fatal(cb.openExpire - cb.now())
+	}
+	advance(cb, 30*time.Second)
+	RequireState(t, cb, StateOpen)
+	advance(cb, time.Second)
+	RequireState(t, cb, StateHalfOpen)
+	if reasons[len(reasons)-1] != ReasonMaxOpenDuration {
+		t.Fatal(reasons)
+	}
+}
+
+func TestCircuitBreakerMaxHalfOpenDuration(t *testing.T) {
+	for _, closeOnTimeout := range []bool{false, true} {
+		var reasons []Reason
+		cb := NewCircuitBreaker(10, 3,
+			WithMaxHalfOpenDuration(20*time.Second, closeOnTimeout),
+			WithOnStateChange(func(name string, from, to uint32, reason Reason, counts Counts) {
+				reasons = append(reasons, reason)
+			}))
+		// 进入半开启状态后没有任何流量
+		DriveToHalfOpen(cb)
+		advance(cb, 20*time.Second)
+		RequireState(t, cb, StateHalfOpen)
+		advance(cb, time.Second)
+		want := StateOpen
+		if closeOnTimeout {
+			want = StateClosed
+		}
+		RequireState(t, cb, want)
+		if reasons[len(reasons)-1] != ReasonMaxHalfOpenDuration {
+			t.Fatal(closeOnTimeout, reasons)
+		}
+	}
+}
+
+func TestCircuitBreakerMinimumClosedDuration(t *testing.T) {
+	cb := NewCircuitBreaker(10, 1, WithMinimumClosedDuration(30*time.Second, 1))
+	DriveToHalfOpen(cb)
+	_ = success(cb)
+	RequireState(t, cb, StateClosed)
+	// 刚刚恢复，一次失败不会立即重新开启
+	_ = fail(cb)
+	RequireState(t, cb, StateClosed)
+	_ = fail(cb)
+	RequireState(t, cb, StateOpen)
+
+	DriveToHalfOpen(cb)
+	_ = success(cb)
+	advance(cb, 30*time.Second)
+	_ = fail(cb)
+	RequireState(t, cb, StateOpen)
+
+	// 不是从半开启状态恢复的关闭状态不受影响
+	cb = NewCircuitBreaker(10, 1, WithMinimumClosedDuration(30*time.Second, 1))
+	_ = fail(cb)
+	RequireState(t, cb, StateOpen)
+}
+
+func TestCircuitBreakerStartupGracePeriod(t *testing.T) {
+	start := time.Unix(1000, 0)
+	now := start
+	cb := NewCircuitBreaker(10, 2, WithStartupGracePeriod(30*time.Second), WithClock(func() time.Time { return now }))
+	for i := 0; i < 10; i++ {
+		_ = fail(cb)
+	}
+	// 宽限期内失败照常记录，但不开启
+	RequireState(t, cb, StateClosed)
+	if m := cb.Metrics(); m.Failures != 10 || m.ContinuousFailures != 2 {
+		t.Fatal(m)
+	}
+	now = start.Add(29 * time.Second)
+	_ = fail(cb)
+	RequireState(t, cb, StateClosed)
+	now = start.Add(30 * time.Second)
+	_ = success(cb)
+	_ = fail(cb)
+	RequireState(t, cb, StateClosed)
+	_ = fail(cb)
+	RequireState(t, cb, StateOpen)
+}
+
+func TestCircuitBreakerCooldownAfterClose(t *testing.T) {
+	cb := NewCircuitBreaker(10, 2, WithCooldownAfterClose(2))
+	DriveToHalfOpen(cb)
+	_ = success(cb)
+	_ = success(cb)
+	RequireState(t, cb, StateClosed)
+	// 恢复后的前两次失败被额度抵消
+	_ = fail(cb)
+	_ = fail(cb)
+	RequireState(t, cb, StateClosed)
+	if c := cb.Counts(); c.Failures != 2 || c.ContinuousFailures != 0 {
+		t.Fatal(c)
+	}
+	// 持续失败仍然会重新开启
+	_ = fail(cb)
+	_ = fail(cb)
+	RequireState(t, cb, StateOpen)
+
+	// 关闭之后的成功消耗额度
+	DriveToHalfOpen(cb)
+	for i := 0; i < 4; i++ {
+		_ = success(cb)
+	}
+	_ = fail(cb)
+	_ = fail(cb)
+	RequireState(t, cb, StateOpen)
+}
+
+func TestCircuitBreakerRecoveryConfirmWindow(t *testing.T) {
+	cb := NewCircuitBreaker(10, 1, WithRecoveryConfirmWindow(5*time.Second))
+	DriveToHalfOpen(cb)
+	_ = success(cb)
+	// 满足恢复条件，但仍在确认窗口内
+	RequireState(t, cb, StateHalfOpen)
+	advance(cb, time.Second)
+	_ = success(cb)
+	RequireState(t, cb, StateHalfOpen)
+	// 窗口内的失败阻止关闭
+	_ = fail(cb)
+	RequireState(t, cb, StateOpen)
+
+	DriveToHalfOpen(cb)
+	_ = success(cb)
+	advance(cb, 4*time.Second)
+	RequireState(t, cb, StateHalfOpen)
+	advance(cb, time.Second)
+	RequireState(t, cb, StateClosed)
+}
+
+func TestCircuitBreakerResetCounts(t *testing.T) {
+	cb := NewCircuitBreaker(60, 3, WithBucketedWindow(10, 6))
+	_ = fail(cb)
+	_ = fail(cb)
+	cycle, err := cb.beforeExecute(cb.now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cb.ResetCounts()
+	RequireState(t, cb, StateClosed)
+	if cb.Counts() != (Counts{}) {
+		t.Fatal(cb.Counts())
+	}
+	// 清空之前放行的请求的结果被丢弃
+	cb.afterExecute(cycle, false, cb.now())
+	_ = fail(cb)
+	_ = fail(cb)
+	RequireState(t, cb, StateClosed)
+	_ = fail(cb)
+	RequireState(t, cb, StateOpen)
+
+	// 开启状态下不改变失效时间
+	expire := cb.openExpire
+	advance(cb, 30*time.Second)
+	cb.ResetCounts()
+	RequireState(t, cb, StateOpen)
+	if cb.openExpire != expire {
+		t.Fatal(cb.openExpire, expire)
+	}
+	advance(cb, 31*time.Second)
+	RequireState(t, cb, StateHalfOpen)
+}
+
+func TestCircuitBreakerTap(t *testing.T) {
+	cb := NewCircuitBreaker(60, 2, WithTap(func(success bool) bool { return true }))
+	for i := 0; i < 10; i++ {
+		_ = fail(cb)
+	}
+	RequireState(t, cb, StateClosed)
+	if m := cb.Metrics(); m.Successes != 10 || m.Failures != 0 {
+		t.Fatal(m)
+	}
+}
+
+func TestCircuitBreakerCountFailure(t *testing.T) {
+	badInput := true
+	asked := 0
+	cb := NewCircuitBreaker(60, 2, WithCountFailure(func() bool {
+		asked++
+		return !badInput
+	}))
+	_ = success(cb)
+	for i := 0; i < 10; i++ {
+		_ = fail(cb)
+	}
+	RequireState(t, cb, StateClosed)
+	// 只在失败时询问，不计入的失败也不占用请求数
+	if m := cb.Metrics(); asked != 10 || m.Failures != 0 || cb.Counts() != (Counts{Requests: 1, ContinuousSuccesses: 1, Successes: 1}) {
+		t.Fatal(asked, m, cb.Counts())
+	}
+	badInput = false
+	_ = fail(cb)
+	_ = fail(cb)
+	RequireState(t, cb, StateOpen)
+}
+
+func TestCircuitBreakerExecuteN(t *testing.T) {
+	cb := NewCircuitBreaker(60, 5)
+	if err := cb.ExecuteN(3, func() bool { return false }); err != nil {
+		t.Fatal(err)
+	}
+	RequireState(t, cb, StateClosed)
+	if c := cb.Counts(); c.Requests != 1 || c.Failures != 3 || c.ContinuousFailures != 3 {
+		t.Fatal(c)
+	}
+	// 一次单位权重的失败不会开启，一次权重为5的失败直接开启
+	cb = NewCircuitBreaker(60, 5)
+	_ = fail(cb)
+	RequireState(t, cb, StateClosed)
+	_ = cb.ExecuteN(5, func() bool { return false })
+	RequireState(t, cb, StateOpen)
+	if m := cb.Metrics(); m.Failures != 6 {
+		t.Fatal(m)
+	}
+
+	DriveToHalfOpen(cb)
+	_ = cb.ExecuteN(5, func() bool { return true })
+	RequireState(t, cb, StateClosed)
+
+	// 加权的成功是一次请求，WithHalfOpenSuccessSpread不会拒绝其中的后几次
+	cb = NewCircuitBreaker(60, 3, WithHalfOpenSuccessSpread(10))
+	DriveToHalfOpen(cb)
+	_ = cb.ExecuteN(3, func() bool { return true })
+	RequireState(t, cb, StateClosed)
+
+	// 额度抵消加权失败中的一部分，剩余的部分照常计入
+	cb = NewCircuitBreaker(60, 2, WithCooldownAfterClose(2))
+	DriveToHalfOpen(cb)
+	_ = success(cb)
+	_ = success(cb)
+	RequireState(t, cb, StateClosed)
+	_ = cb.ExecuteN(3, func() bool { return false })
+	RequireState(t, cb, StateClosed)
+	if c := cb.Counts(); c.Failures != 3 || c.ContinuousFailures != 1 {
+		t.Fatal(c)
+	}
+	_ = fail(cb)
+	RequireState(t, cb, StateOpen)
+}
+
+func TestCircuitBreakerNil(t *testing.T) {
+	var cb *CircuitBreaker
+	called := 0
+	if err := cb.Execute(func() bool { called++; return false }); err != nil {
+		t.Fatal(err)
+	}
+	if err := cb.ExecuteContext(context.Background(), func(context.Context) bool { called++; return false }); err != nil {
+		t.Fatal(err)
+	}
+	if called != 2 || cb.State() != StateClosed {
+		t.Fatal(called, cb.State())
+	}
+}
+
+func TestCircuitBreakerHalfOpenSuccessDecay(t *testing.T) {
+	cb := NewCircuitBreaker(60, 3, WithHalfOpenSuccessDecay(10*time.Second))
+	DriveToHalfOpen(cb)
+	// 成功之间间隔太久，始终无法积累足够的连续成功
+	for i := 0; i < 5; i++ {
+		if err := success(cb); err != nil {
+			t.Fatal(i, err)
+		}
+		advance(cb, 11*time.Second)
+	}
+	RequireState(t, cb, StateHalfOpen)
+	if cb.Counts().ContinuousSuccesses != 1 {
+		t.Fatal(cb.Counts())
+	}
+	// 间隔不超过decay的成功正常累计
+	_ = success(cb)
+	advance(cb, 10*time.Second)
+	_ = success(cb)
+	_ = success(cb)
+	RequireState(t, cb, StateClosed)
+}
+
+func TestCircuitBreakerRejectionErrors(t *testing.T) {
+	rejections := []error{ErrOpenState, ErrTooManyRequests, ErrShedding, ErrConcurrencyLimit}
+	for i, a := range rejections {
+		for j, b := range rejections {
+			if errors.Is(a, b) != (i == j) {
+				t.Fatal(a, b)
+			}
+		}
+	}
+	cb := NewCircuitBreaker(60, 2, WithSoftThreshold(1, func(failures, soft, hard uint32) float64 { return 1 }))
+	_ = fail(cb)
+	if err := success(cb); err != ErrShedding {
+		t.Fatal(err)
+	}
+	_, _ = cb.ExecuteBypass(func() bool { return false })
+	if err := success(cb); err != ErrOpenState {
+		t.Fatal(err)
+	}
+	DriveToHalfOpen(cb)
+	for i := 0; i < 2; i++ {
+		if _, err := cb.beforeExecute(cb.now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := success(cb); err != ErrTooManyRequests {
+		t.Fatal(err)
+	}
+}
+
+func TestCircuitBreakerFastPath(t *testing.T) {
+	cb := NewCircuitBreaker(60, 2)
+	if !cb.fastPath {
+		t.Fatal(cb.fastPath)
+	}
+	for _, opt := range []Option{WithBucketedWindow(10, 6), WithObserver(NopObserver{}), WithSoftThreshold(1, nil), WithTap(func(bool) bool { return true })} {
+		if NewCircuitBreaker(60, 2, opt).fastPath {
+			t.Fatal("fast path with features")
+		}
+	}
+	_ = fail(cb)
+	_ = success(cb)
+	if c := cb.Counts(); c != (Counts{Requests: 2, ContinuousSuccesses: 1, Successes: 1, Failures: 1}) {
+		t.Fatal(c)
+	}
+	_ = fail(cb)
+	_ = fail(cb)
+	RequireState(t, cb, StateOpen)
+	if err := success(cb); err != ErrOpenState {
+		t.Fatal(err)
+	}
+	DriveToHalfOpen(cb)
+	_ = success(cb)
+	_ = success(cb)
+	RequireState(t, cb, StateClosed)
+	if m := cb.Metrics(); m.Successes != 3 || m.Failures != 3 || m.Rejections != 1 {
+		t.Fatal(m)
+	}
+}
+
+func TestCircuitBreakerErrorPredicate(t *testing.T) {
+	errNotFound := errors.New("not found")
+	var lastErr error
+	cb := NewCircuitBreaker(60, 2, WithErrorPredicate(
+		func() error { return lastErr },
+		func(err error) bool { return err != errNotFound },
+	))
+	notFound := func() bool {
+		lastErr = errNotFound
+		return false
+	}
+	for i := 0; i < 5; i++ {
+		if err := cb.Execute(notFound); err != nil {
+			t.Fatal(err)
+		}
+	}
+	RequireState(t, cb, StateClosed)
+	if c := cb.Counts(); c != (Counts{}) {
+		t.Fatal(c)
+	}
+	// 其它错误仍然计为失败
+	lastErr = errors.New("timeout")
+	_ = fail(cb)
+	_ = fail(cb)
+	RequireState(t, cb, StateOpen)
+}
+
+func TestCircuitBreakerSwapCounts(t *testing.T) {
+	cb := NewCircuitBreaker(60, 5)
+	_ = success(cb)
+	_ = fail(cb)
+	if c := cb.SwapCounts(); c != (Counts{Requests: 2, ContinuousFailures: 1, Successes: 1, Failures: 1}) {
+		t.Fatal(c)
+	}
+	if c := cb.Counts(); c != (Counts{}) {
+		t.Fatal(c)
+	}
+
+	const workers, calls = 8, 2000
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < calls; j++ {
+				_ = success(cb)
+			}
+		}()
+	}
+	var reported uint32
+	swaps := 0
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+			reported += cb.SwapCounts().Successes
+			swaps++
+		}
+	}
+	reported += cb.SwapCounts().Successes
+	// 跨越SwapCounts的请求的结果被丢弃，但不会被重复上报
+	if lost := workers*calls - int(reported); lost < 0 || lost > swaps*workers {
+		t.Fatal(reported, swaps)
+	}
+	RequireState(t, cb, StateClosed)
+}
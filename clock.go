@@ -0,0 +1,39 @@
+package main
+
+import "time"
+
+// 熔断器内部使用秒级的时间戳，它等于创建熔断器时的系统时间加上之后经过的时间
+// 经过的时间通过time.Time自带的单调时钟读数计算，因此系统时间被NTP等调整(包括向前回拨)不会影响开启周期等时间间隔的计算
+
+// Now 熔断器默认使用的时间源，测试中可以临时替换为可控的时钟，替换后只影响之后创建的熔断器的创建时间以及所有熔断器之后读取的时间
+// 时间源的优先级为：WithClock配置的熔断器自己的时钟 > Now > 系统时间。Now不是并发安全的，只应在测试中替换，并在测试结束时恢复
+var Now = time.Now
+
+// sinceNow 熔断器默认的since，与time.Since相同但使用Now
+func sinceNow(t time.Time) time.Duration {
+	return Now().Sub(t)
+}
+
+// now 返回熔断器当前的时间戳
+func (cb *CircuitBreaker) now() int64 {
+	return cb.unixAfter(cb.since(cb.epoch))
+}
+
+// clock 返回熔断器时钟的当前时间，用于测量请求的执行耗时，与now使用相同的时间源
+func (cb *CircuitBreaker) clock() time.Time {
+	return cb.epoch.Add(cb.since(cb.epoch))
+}
+
+// unix 将t转换为熔断器的时间戳，t带有单调时钟读数时同样不受系统时间调整的影响
+func (cb *CircuitBreaker) unix(t time.Time) int64 {
+	return cb.unixAfter(t.Sub(cb.epoch))
+}
+
+func (cb *CircuitBreaker) unixAfter(elapsed time.Duration) int64 {
+	d := elapsed + time.Duration(cb.epoch.Nanosecond())
+	sec := int64(d / time.Second)
+	if d < 0 && d%time.Second != 0 {
+		sec--
+	}
+	return cb.epoch.Unix() + sec
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerUnix(t *testing.T) {
+	cb := NewCircuitBreaker(60, 1)
+	cb.epoch = time.Unix(1000, 600*int64(time.Millisecond))
+	cases := map[time.Time]int64{
+		time.Unix(1000, 0):                           1000,
+		time.Unix(1000, 999*int64(time.Millisecond)): 1000,
+		time.Unix(1001, 0):                           1001,
+		time.Unix(999, 999*int64(time.Millisecond)):  999,
+		time.Unix(900, 0):                            900,
+	}
+	for tm, want := range cases {
+		if got := cb.unix(tm); got != want {
+			t.Fatal(tm, got, want)
+		}
+	}
+}
+
+func TestCircuitBreakerWallClockJump(t *testing.T) {
+	// 系统时间被向前回拨了一个小时，单调时钟仍然正常前进
+	var elapsed time.Duration
+	cb := NewCircuitBreaker(10, 1)
+	cb.since = func(time.Time) time.Duration { return elapsed }
+	wall := func() int64 { return time.Now().Add(-time.Hour).Unix() }
+
+	elapsed = time.Second
+	_ = fail(cb)
+	if cb.State() != StateOpen {
+		t.Fatal(cb.State())
+	}
+	// 按系统时间计算，开启周期要一个多小时后才结束
+	if cb.openExpire-wall() < int64(time.Hour/time.Second) {
+		t.Fatal(cb.openExpire, wall())
+	}
+	elapsed = 10 * time.Second
+	if cb.State() != StateOpen {
+		t.Fatal(cb.State())
+	}
+	// 经过真实的开启周期后切换到半开启状态
+	elapsed = 12 * time.Second
+	if cb.State() != StateHalfOpen {
+		t.Fatal(cb.State())
+	}
+	if err := success(cb); err != nil || cb.State() != StateClosed {
+		t.Fatal(err, cb.State())
+	}
+}
+
+func TestCircuitBreakerPackageNow(t *testing.T) {
+	defer func(now func() time.Time) { Now = now }(Now)
+	fake := time.Unix(1000, 0)
+	Now = func() time.Time { return fake }
+
+	cb := NewCircuitBreaker(60, 1)
+	_ = fail(cb)
+	RequireState(t, cb, StateOpen)
+	fake = fake.Add(61 * time.Second)
+	RequireState(t, cb, StateHalfOpen)
+
+	// 熔断器自己的时钟优先于Now
+	own := time.Unix(5000, 0)
+	cb = NewCircuitBreaker(60, 1, WithClock(func() time.Time { return own }))
+	_ = fail(cb)
+	fake = fake.Add(time.Hour)
+	RequireState(t, cb, StateOpen)
+	own = own.Add(61 * time.Second)
+	RequireState(t, cb, StateHalfOpen)
+}
@@ -0,0 +1,53 @@
+package main
+
+import "fmt"
+
+// RejectedError Composite中的某个熔断器拒绝请求时返回的错误，Err为该熔断器返回的错误(ErrOpenState等)
+// 可以通过errors.Is(err, ErrOpenState)判断拒绝的原因，通过errors.As取出拒绝请求的熔断器名称
+// 只有Composite.Execute和ExecuteContextErr返回*RejectedError；单个熔断器的Execute等方法为了兼容err == ErrOpenState的判断，
+// 仍然直接返回ErrOpenState等错误，因此对单个熔断器errors.As取不到*RejectedError。
+// 需要同时处理单个熔断器和Composite的拒绝时，应当使用errors.Is判断拒绝的原因
+type RejectedError struct {
+	Name string
+	Err  error
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("circuit breaker %q: %v", e.Name, e.Err)
+}
+
+func (e *RejectedError) Unwrap() error {
+	return e.Err
+}
+
+// Composite 由多个熔断器组成的组合熔断器，例如同时使用接口级别和服务级别的熔断器保护同一个请求
+type Composite struct {
+	breakers []*CircuitBreaker
+}
+
+// Chain 按顺序组合多个熔断器
+func Chain(breakers ...*CircuitBreaker) *Composite {
+	return &Composite{breakers: breakers}
+}
+
+// Execute 按顺序检查每个熔断器是否放行请求，全部放行后执行一次f并将结果报告给所有熔断器
+// 任意一个熔断器拒绝时返回包装了该熔断器的错误和名称的*RejectedError，之前已经放行的熔断器会撤销本次请求
+func (c *Composite) Execute(f func() bool) error {
+	cycles := make([]uint32, len(c.breakers))
+	for i, cb := range c.breakers {
+		cycle, err := cb.beforeExecute(cb.now())
+		if err != nil {
+			for j := 0; j < i; j++ {
+				c.breakers[j].cancel(cycles[j])
+			}
+			return &RejectedError{Name: cb.name, Err: err}
+		}
+		defer cb.leaveConcurrency()
+		cycles[i] = cycle
+	}
+	success := f()
+	for i, cb := range c.breakers {
+		cb.afterExecute(cycles[i], success, cb.now())
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCompositeOuterRejects(t *testing.T) {
+	outer := NewCircuitBreaker(60, 2)
+	inner := NewCircuitBreaker(60, 2)
+	c := Chain(outer, inner)
+	for i := 0; i < 2; i++ {
+		_ = fail(outer)
+	}
+	executed := false
+	err := c.Execute(func() bool {
+		executed = true
+		return true
+	})
+	if !errors.Is(err, ErrOpenState) || executed {
+		t.Fatal(err, executed)
+	}
+	if inner.state != StateClosed || inner.s.requests != 0 {
+		t.Fatal(inner.state, inner.s.requests)
+	}
+}
+
+func TestCompositeInnerRejects(t *testing.T) {
+	outer := NewCircuitBreaker(60, 2)
+	inner := NewCircuitBreaker(60, 2)
+	c := Chain(outer, inner)
+	for i := 0; i < 2; i++ {
+		_ = fail(inner)
+	}
+	// outer的开启周期已经过去，下一次请求时切换到半开启状态
+	outer.switchState(StateClosed, StateOpen, -100, ReasonManual)
+	if err := c.Execute(func() bool { return true }); !errors.Is(err, ErrOpenState) {
+		t.Fatal(err)
+	}
+	// outer放行的请求被撤销，不占用半开启状态的探测名额
+	if outer.state != StateHalfOpen || outer.s.requests != 0 {
+		t.Fatal(outer.state, outer.s.requests)
+	}
+}
+
+func TestCompositeReportsAll(t *testing.T) {
+	outer := NewCircuitBreaker(60, 5)
+	inner := NewCircuitBreaker(60, 2)
+	c := Chain(outer, inner)
+	for i := 0; i < 2; i++ {
+		if err := c.Execute(func() bool { return false }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if outer.s.continuousFailures != 2 || outer.state != StateClosed {
+		t.Fatal(outer.s.continuousFailures, outer.state)
+	}
+	if inner.state != StateOpen {
+		t.Fatal(inner.state)
+	}
+	if err := c.Execute(func() bool { return true }); !errors.Is(err, ErrOpenState) {
+		t.Fatal(err)
+	}
+}
+
+func TestCompositeRejectedError(t *testing.T) {
+	outer := NewCircuitBreaker(60, 2, WithName("service"))
+	inner := NewCircuitBreaker(60, 1, WithName("endpoint"))
+	c := Chain(outer, inner)
+	DriveToHalfOpen(inner)
+	_, _ = inner.beforeExecute(inner.now())
+	err := c.Execute(func() bool { return true })
+	var rejected *RejectedError
+	if !errors.As(err, &rejected) || rejected.Name != "endpoint" || rejected.Err != ErrTooManyRequests {
+		t.Fatal(err)
+	}
+	if !errors.Is(err, ErrTooManyRequests) || errors.Is(err, ErrOpenState) {
+		t.Fatal(err)
+	}
+	if err.Error() != `circuit breaker "endpoint": too many requests` {
+		t.Fatal(err)
+	}
+
+	DriveToOpen(outer)
+	err = c.Execute(func() bool { return true })
+	if !errors.As(err, &rejected) || rejected.Name != "service" || !errors.Is(err, ErrOpenState) {
+		t.Fatal(err)
+	}
+}
+
+func TestRejectedErrorSingleBreaker(t *testing.T) {
+	// 单个熔断器返回错误本身，errors.Is对单个熔断器和Composite的拒绝同样有效
+	cb := NewCircuitBreaker(60, 1, WithName("endpoint"))
+	DriveToOpen(cb)
+	err := success(cb)
+	var rejected *RejectedError
+	if err != ErrOpenState || errors.As(err, &rejected) {
+		t.Fatal(err)
+	}
+	chained := Chain(cb).Execute(func() bool { return true })
+	if !errors.Is(err, ErrOpenState) || !errors.Is(chained, ErrOpenState) {
+		t.Fatal(err, chained)
+	}
+}
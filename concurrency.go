@@ -0,0 +1,27 @@
+package main
+
+import "sync/atomic"
+
+// enterConcurrency 配置了WithMaxConcurrency时占用一个并发名额，名额已满时返回false
+func (cb *CircuitBreaker) enterConcurrency() bool {
+	if cb.maxConcurrency == 0 {
+		return true
+	}
+	if atomic.AddInt32(&cb.inFlight, 1) > cb.maxConcurrency {
+		atomic.AddInt32(&cb.inFlight, -1)
+		return false
+	}
+	return true
+}
+
+// leaveConcurrency 归还enterConcurrency占用的并发名额
+func (cb *CircuitBreaker) leaveConcurrency() {
+	if cb.maxConcurrency > 0 {
+		atomic.AddInt32(&cb.inFlight, -1)
+	}
+}
+
+// InFlight 返回正在执行的请求数，只在配置了WithMaxConcurrency时统计，否则返回0
+func (cb *CircuitBreaker) InFlight() int32 {
+	return atomic.LoadInt32(&cb.inFlight)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerMaxConcurrency(t *testing.T) {
+	cb := NewCircuitBreaker(60, 3, WithMaxConcurrency(2))
+	release := make(chan struct{})
+	results := make([]<-chan error, 2)
+	for i := range results {
+		results[i] = cb.ExecuteAsync(func() bool {
+			<-release
+			return true
+		})
+	}
+	deadline := time.Now().Add(time.Second)
+	for cb.InFlight() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal(cb.InFlight())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// 名额已满时拒绝请求，f不会被执行，与熔断器的状态无关
+	if err := cb.Execute(func() bool {
+		t.Fatal("executed over the concurrency limit")
+		return true
+	}); err != ErrConcurrencyLimit {
+		t.Fatal(err)
+	}
+	RequireState(t, cb, StateClosed)
+	if counts, m := cb.Counts(), cb.Metrics(); counts.Requests != 2 || m.Rejections != 1 {
+		t.Fatal(counts, m)
+	}
+
+	close(release)
+	for _, result := range results {
+		if err := <-result; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := cb.InFlight(); n != 0 {
+		t.Fatal(n)
+	}
+	if err := success(cb); err != nil {
+		t.Fatal(err)
+	}
+	if cb.Options().MaxConcurrency != 2 {
+		t.Fatal(cb.Options())
+	}
+}
+
+func TestCircuitBreakerMaxConcurrencyRejected(t *testing.T) {
+	// 被熔断器拒绝的请求不占用并发名额
+	cb := NewCircuitBreaker(60, 1, WithMaxConcurrency(1))
+	DriveToOpen(cb)
+	for i := 0; i < 3; i++ {
+		if err := success(cb); err != ErrOpenState {
+			t.Fatal(err)
+		}
+	}
+	if n := cb.InFlight(); n != 0 {
+		t.Fatal(n)
+	}
+	// 半开启状态下的探测请求照常占用名额，结束后归还
+	DriveToHalfOpen(cb)
+	if err := success(cb); err != nil {
+		t.Fatal(err)
+	}
+	RequireState(t, cb, StateClosed)
+	if n := cb.InFlight(); n != 0 {
+		t.Fatal(n)
+	}
+}
+
+// waitInFlight 等待正在执行的请求数变为n
+func waitInFlight(t *testing.T, cb *CircuitBreaker, n int32) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for cb.InFlight() != n {
+		if time.Now().After(deadline) {
+			t.Fatal(cb.InFlight(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCircuitBreakerMaxConcurrencyAbandoned(t *testing.T) {
+	// ctx结束后ExecuteContext提前返回，仍在执行的f继续占用名额
+	cb := NewCircuitBreaker(60, 3, WithMaxConcurrency(1))
+	release := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		waitInFlight(t, cb, 1)
+		cancel()
+	}()
+	if err := cb.ExecuteContext(ctx, func(ctx context.Context) bool {
+		<-release
+		return true
+	}); err != context.Canceled {
+		t.Fatal(err)
+	}
+	if err := success(cb); err != ErrConcurrencyLimit {
+		t.Fatal(err)
+	}
+	close(release)
+	waitInFlight(t, cb, 0)
+	if err := success(cb); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCircuitBreakerMaxConcurrencyHedged(t *testing.T) {
+	var calls int32
+	// slowFirst 第一次尝试等到slow关闭后才返回，之后的尝试立即成功
+	slowFirst := func(slow chan struct{}) func() bool {
+		atomic.StoreInt32(&calls, 0)
+		return func() bool {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				<-slow
+			}
+			return true
+		}
+	}
+	// 名额已满时不发出备份请求
+	cb := NewCircuitBreaker(60, 3, WithMaxConcurrency(1))
+	slow := make(chan struct{})
+	time.AfterFunc(50*time.Millisecond, func() { close(slow) })
+	if err := cb.ExecuteHedged(time.Millisecond, slowFirst(slow)); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatal(n)
+	}
+	waitInFlight(t, cb, 0)
+
+	// 备份请求先成功后，仍在执行的第一次尝试继续占用名额
+	cb = NewCircuitBreaker(60, 3, WithMaxConcurrency(2))
+	slow = make(chan struct{})
+	if err := cb.ExecuteHedged(time.Millisecond, slowFirst(slow)); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatal(n)
+	}
+	waitInFlight(t, cb, 1)
+	close(slow)
+	waitInFlight(t, cb, 0)
+}
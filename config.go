@@ -0,0 +1,448 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Config 熔断器的完整配置，可以集中定义后用于创建多个熔断器
+// 零值字段使用默认值，与NewCircuitBreaker及对应的Option行为一致
+type Config struct {
+	// OpenInterval 熔断器开启的时间周期，单位秒，默认60
+	OpenInterval int64
+	// Threshold 触发开启的失败数以及半开启状态下的探测请求数，默认5
+	Threshold uint32
+	// SoftThreshold 关闭状态下开始按概率拒绝请求的连续失败数，0表示不开启
+	SoftThreshold uint32
+	// SheddingCurve 关闭状态下拒绝请求的概率曲线，默认LinearShedding
+	SheddingCurve SheddingCurve
+	// WindowInterval 滑动窗口每个桶的时间跨度，单位秒，与WindowBuckets同时配置时生效
+	WindowInterval int64
+	// WindowBuckets 滑动窗口的桶数
+	WindowBuckets int
+	// SaturationRatio 半开启状态下被拒绝的请求占比达到此值时延长下一次开启的时间周期，0表示不开启
+	SaturationRatio float64
+	// SaturationFactor 延长开启时间周期的倍数
+	SaturationFactor int64
+	// LateSuccessStep 每个迟到的成功结果将下一次开启的时间周期缩短的秒数，0表示丢弃迟到的结果
+	LateSuccessStep int64
+	// FailureRatio 关闭状态下触发开启的失败率，0表示不开启
+	FailureRatio float64
+	// MinRequests 按失败率开启所需的最少请求数
+	MinRequests uint32
+	// ObservationSampling 关闭状态下按失败率开启时抽样记录的请求结果比例，0表示记录全部结果
+	ObservationSampling float64
+	// VolumeWindowInterval 计算失败率的滑动窗口每个桶的时间跨度，单位秒，与VolumeWindowBuckets同时配置时生效
+	VolumeWindowInterval int64
+	// VolumeWindowBuckets 计算失败率的滑动窗口的桶数
+	VolumeWindowBuckets int
+	// HalfOpenSuccessRatio 半开启状态下关闭熔断器所需的成功率，0表示按连续成功数判断
+	HalfOpenSuccessRatio float64
+	// HalfOpenMinRequests 按成功率判断是否恢复所需的最少请求数
+	HalfOpenMinRequests uint32
+	// RecoveryConfirmWindow 半开启状态下满足恢复条件之后关闭熔断器之前的确认窗口，0表示立即关闭
+	RecoveryConfirmWindow time.Duration
+	// OpenSampling 开启状态下放行请求的概率，0表示不放行
+	OpenSampling float64
+	// RampUp 半开启状态下按连续成功数逐步提高的放行比例，为空表示只放行Threshold个探测请求
+	RampUp []float64
+	// ProbeTimeout 半开启状态下探测请求的超时时间，单位秒，0表示不开启
+	ProbeTimeout int64
+	// StaleProbeReset 半开启状态下没有探测请求返回多久之后归还未返回的请求占用的名额，0表示不开启
+	StaleProbeReset time.Duration
+	// HalfOpenSuccessSpread 半开启状态下两次计入统计的成功之间至少间隔的秒数，0表示不限制
+	HalfOpenSuccessSpread int64
+	// HalfOpenSuccessDecay 半开启状态下两次成功间隔超过此时间时之前的连续成功失效，0表示不失效
+	HalfOpenSuccessDecay time.Duration
+	// HalfOpenQueue 半开启状态下探测名额已满时请求等待名额的最长时间，0表示直接拒绝
+	HalfOpenQueue time.Duration
+	// MaxConcurrency 同时执行的请求数上限，超过时返回ErrConcurrencyLimit，0表示不限制
+	MaxConcurrency uint32
+	// FailedProbeBackoffFactor 每次恢复失败后再次开启的时间周期的倍数，0表示不开启
+	FailedProbeBackoffFactor int64
+	// FailedProbeBackoffMax 逐次延长的开启时间周期的上限，单位秒，0表示不限制
+	FailedProbeBackoffMax int64
+	// MaxOpenDuration 开启状态最长持续的时间，超过后强制切换到半开启状态，0表示不限制
+	MaxOpenDuration time.Duration
+	// MaxHalfOpenDuration 半开启状态最长持续的时间，超过后强制切换到开启状态，0表示不限制
+	MaxHalfOpenDuration time.Duration
+	// MaxHalfOpenClose 半开启状态持续超过MaxHalfOpenDuration后切换到关闭状态而不是开启状态
+	MaxHalfOpenClose bool
+	// CooldownAfterClose 每次切换到关闭状态时抵消失败的额度，0表示不开启
+	CooldownAfterClose uint32
+	// StartupGracePeriod 创建熔断器之后不会开启熔断器的时间，0表示不开启
+	StartupGracePeriod time.Duration
+	// MinimumClosedDuration 从半开启状态恢复之后开启熔断器所需的失败数增加MinimumClosedForgiveness的时间，0表示不开启
+	MinimumClosedDuration time.Duration
+	// MinimumClosedForgiveness MinimumClosedDuration内额外允许的失败数
+	MinimumClosedForgiveness uint32
+	// SlowCallDuration 执行耗时达到此值的请求视为慢调用，0表示不检测慢调用
+	SlowCallDuration time.Duration
+	// SlowCallCount 关闭状态下触发开启的连续慢调用数
+	SlowCallCount uint32
+	// SlowCallPercentile 按最近请求耗时的此分位检测慢调用，0表示使用固定的SlowCallDuration
+	SlowCallPercentile float64
+	// SlowCallMultiplier 耗时达到SlowCallPercentile分位的此倍数时视为慢调用
+	SlowCallMultiplier float64
+	// RecentErrors RecentErrors保存的最近失败的错误数，0表示默认只保存最近一次
+	RecentErrors int
+	// IgnoreIsolatedFailures 关闭状态下忽略紧接着成功的单次失败
+	IgnoreIsolatedFailures bool
+	// ResetFailuresOnSuccess 关闭状态下成功是否清零连续失败数，nil表示按是否配置了滑动窗口决定
+	ResetFailuresOnSuccess *bool
+	// BatchAggregation ExecuteBatch汇总结果的方式，默认BatchAllSuccess
+	BatchAggregation BatchAggregation
+	// OutcomeFunc 判断请求计入统计方式的函数，参考WithOutcomeFunc
+	OutcomeFunc func(result interface{}, err error) Outcome
+	// AdmissionPolicy 自定义的放行策略
+	AdmissionPolicy AdmissionPolicy
+	// TransitionStrategy 自定义的状态切换规则
+	TransitionStrategy TransitionStrategy
+}
+
+// Validate 检查配置中是否存在非法或相互矛盾的字段
+func (c Config) Validate() error {
+	var errs []string
+	if c.OpenInterval < 0 {
+		errs = append(errs, "OpenInterval must not be negative")
+	}
+	threshold := c.Threshold
+	if threshold == 0 {
+		threshold = loadDefaultThreshold()
+	}
+	if c.SoftThreshold != 0 && c.SoftThreshold >= threshold {
+		errs = append(errs, "SoftThreshold must be less than Threshold")
+	}
+	if c.SoftThreshold == 0 && c.SheddingCurve != nil {
+		errs = append(errs, "SheddingCurve requires SoftThreshold")
+	}
+	if c.SoftThreshold != 0 && c.AdmissionPolicy != nil {
+		errs = append(errs, "SoftThreshold has no effect with a custom AdmissionPolicy")
+	}
+	if c.WindowInterval < 0 || c.WindowBuckets < 0 {
+		errs = append(errs, "WindowInterval and WindowBuckets must not be negative")
+	} else if (c.WindowInterval == 0) != (c.WindowBuckets == 0) {
+		errs = append(errs, "WindowInterval and WindowBuckets must be set together")
+	}
+	if c.SaturationRatio < 0 || c.SaturationRatio > 1 {
+		errs = append(errs, "SaturationRatio must be in [0, 1]")
+	} else if c.SaturationRatio > 0 && c.SaturationFactor <= 1 {
+		errs = append(errs, "SaturationFactor must be greater than 1 when SaturationRatio is set")
+	}
+	if c.LateSuccessStep < 0 {
+		errs = append(errs, "LateSuccessStep must not be negative")
+	}
+	if c.FailureRatio < 0 || c.FailureRatio > 1 {
+		errs = append(errs, "FailureRatio must be in [0, 1]")
+	}
+	if c.FailureRatio == 0 && c.MinRequests != 0 {
+		errs = append(errs, "MinRequests requires FailureRatio")
+	}
+	if _, ok := samplingWeight(c.ObservationSampling); c.ObservationSampling != 0 && !ok {
+		errs = append(errs, "ObservationSampling must be 1/n for an integer n >= 2")
+	} else if c.ObservationSampling != 0 && c.FailureRatio == 0 {
+		errs = append(errs, "ObservationSampling requires FailureRatio")
+	}
+	if c.VolumeWindowInterval < 0 || c.VolumeWindowBuckets < 0 {
+		errs = append(errs, "VolumeWindowInterval and VolumeWindowBuckets must not be negative")
+	} else if (c.VolumeWindowInterval == 0) != (c.VolumeWindowBuckets == 0) {
+		errs = append(errs, "VolumeWindowInterval and VolumeWindowBuckets must be set together")
+	} else if c.VolumeWindowInterval != 0 && c.FailureRatio == 0 {
+		errs = append(errs, "VolumeWindowInterval requires FailureRatio")
+	}
+	if c.HalfOpenSuccessRatio < 0 || c.HalfOpenSuccessRatio > 1 {
+		errs = append(errs, "HalfOpenSuccessRatio must be in [0, 1]")
+	}
+	if c.HalfOpenSuccessRatio == 0 && c.HalfOpenMinRequests != 0 {
+		errs = append(errs, "HalfOpenMinRequests requires HalfOpenSuccessRatio")
+	}
+	if c.OpenSampling < 0 || c.OpenSampling > 1 {
+		errs = append(errs, "OpenSampling must be in [0, 1]")
+	} else if c.OpenSampling != 0 && c.AdmissionPolicy != nil {
+		errs = append(errs, "OpenSampling has no effect with a custom AdmissionPolicy")
+	}
+	for _, fraction := range c.RampUp {
+		if fraction <= 0 || fraction > 1 {
+			errs = append(errs, "RampUp fractions must be in (0, 1]")
+			break
+		}
+	}
+	if len(c.RampUp) != 0 && c.AdmissionPolicy != nil {
+		errs = append(errs, "RampUp has no effect with a custom AdmissionPolicy")
+	}
+	if c.RecoveryConfirmWindow < 0 {
+		errs = append(errs, "RecoveryConfirmWindow must not be negative")
+	}
+	if c.ProbeTimeout < 0 {
+		errs = append(errs, "ProbeTimeout must not be negative")
+	}
+	if c.StaleProbeReset < 0 {
+		errs = append(errs, "StaleProbeReset must not be negative")
+	}
+	if c.HalfOpenSuccessSpread < 0 {
+		errs = append(errs, "HalfOpenSuccessSpread must not be negative")
+	}
+	if c.HalfOpenSuccessDecay < 0 {
+		errs = append(errs, "HalfOpenSuccessDecay must not be negative")
+	}
+	if c.HalfOpenQueue < 0 {
+		errs = append(errs, "HalfOpenQueue must not be negative")
+	}
+	if c.FailedProbeBackoffFactor < 0 || c.FailedProbeBackoffFactor == 1 {
+		errs = append(errs, "FailedProbeBackoffFactor must be 0 or greater than 1")
+	}
+	if c.FailedProbeBackoffMax < 0 {
+		errs = append(errs, "FailedProbeBackoffMax must not be negative")
+	} else if c.FailedProbeBackoffMax != 0 && c.FailedProbeBackoffFactor == 0 {
+		errs = append(errs, "FailedProbeBackoffMax requires FailedProbeBackoffFactor")
+	}
+	if c.MaxOpenDuration < 0 {
+		errs = append(errs, "MaxOpenDuration must not be negative")
+	}
+	if c.MaxHalfOpenDuration < 0 {
+		errs = append(errs, "MaxHalfOpenDuration must not be negative")
+	} else if c.MaxHalfOpenClose && c.MaxHalfOpenDuration == 0 {
+		errs = append(errs, "MaxHalfOpenClose requires MaxHalfOpenDuration")
+	}
+	if c.StartupGracePeriod < 0 {
+		errs = append(errs, "StartupGracePeriod must not be negative")
+	}
+	if c.MinimumClosedDuration < 0 {
+		errs = append(errs, "MinimumClosedDuration must not be negative")
+	} else if (c.MinimumClosedDuration == 0) != (c.MinimumClosedForgiveness == 0) {
+		errs = append(errs, "MinimumClosedDuration and MinimumClosedForgiveness must be set together")
+	}
+	if c.RecentErrors < 0 {
+		errs = append(errs, "RecentErrors must not be negative")
+	}
+	if c.SlowCallDuration < 0 {
+		errs = append(errs, "SlowCallDuration must not be negative")
+	}
+	if c.SlowCallPercentile < 0 || c.SlowCallPercentile > 1 {
+		errs = append(errs, "SlowCallPercentile must be between 0 and 1")
+	}
+	if c.SlowCallMultiplier < 0 {
+		errs = append(errs, "SlowCallMultiplier must not be negative")
+	}
+	if (c.SlowCallPercentile == 0) != (c.SlowCallMultiplier == 0) {
+		errs = append(errs, "SlowCallPercentile and SlowCallMultiplier must be set together")
+	}
+	if c.SlowCallDuration > 0 && c.SlowCallPercentile > 0 {
+		errs = append(errs, "SlowCallDuration and SlowCallPercentile are mutually exclusive")
+	} else if c.SlowCallPercentile > 0 && c.SlowCallCount == 0 {
+		errs = append(errs, "SlowCallPercentile and SlowCallCount must be set together")
+	} else if c.SlowCallPercentile == 0 && c.SlowCallDuration >= 0 && (c.SlowCallDuration == 0) != (c.SlowCallCount == 0) {
+		errs = append(errs, "SlowCallDuration and SlowCallCount must be set together")
+	}
+	if c.TransitionStrategy != nil {
+		// 自定义的状态切换规则替换了内置规则中的这些切换条件，参考WithTransitionStrategy
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"WindowInterval", c.WindowInterval != 0},
+			{"SaturationRatio", c.SaturationRatio != 0},
+			{"LateSuccessStep", c.LateSuccessStep != 0},
+			{"FailureRatio", c.FailureRatio != 0},
+			{"HalfOpenSuccessRatio", c.HalfOpenSuccessRatio != 0},
+			{"RecoveryConfirmWindow", c.RecoveryConfirmWindow != 0},
+			{"ProbeTimeout", c.ProbeTimeout != 0},
+			{"StaleProbeReset", c.StaleProbeReset != 0},
+			{"HalfOpenSuccessSpread", c.HalfOpenSuccessSpread != 0},
+			{"HalfOpenSuccessDecay", c.HalfOpenSuccessDecay != 0},
+			{"FailedProbeBackoffFactor", c.FailedProbeBackoffFactor != 0},
+			{"MaxOpenDuration", c.MaxOpenDuration != 0},
+			{"MaxHalfOpenDuration", c.MaxHalfOpenDuration != 0},
+			{"CooldownAfterClose", c.CooldownAfterClose != 0},
+			{"StartupGracePeriod", c.StartupGracePeriod != 0},
+			{"MinimumClosedDuration", c.MinimumClosedDuration != 0},
+			{"IgnoreIsolatedFailures", c.IgnoreIsolatedFailures},
+		} {
+			if f.set {
+				errs = append(errs, f.name+" has no effect with a custom TransitionStrategy")
+			}
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid config: %s", strings.Join(errs, "; "))
+}
+
+// Options 将配置转换为对应的Option
+func (c Config) Options() []Option {
+	var opts []Option
+	if c.SoftThreshold != 0 {
+		opts = append(opts, WithSoftThreshold(c.SoftThreshold, c.SheddingCurve))
+	}
+	if c.WindowInterval != 0 {
+		opts = append(opts, WithBucketedWindow(c.WindowInterval, c.WindowBuckets))
+	}
+	if c.SaturationRatio != 0 {
+		opts = append(opts, WithHalfOpenSaturationBackoff(c.SaturationRatio, c.SaturationFactor))
+	}
+	if c.LateSuccessStep != 0 {
+		opts = append(opts, WithLateSuccessRecovery(c.LateSuccessStep))
+	}
+	if c.FailureRatio != 0 {
+		opts = append(opts, WithFailureRatio(c.FailureRatio, c.MinRequests))
+	}
+	if c.ObservationSampling != 0 {
+		opts = append(opts, WithObservationSampling(c.ObservationSampling))
+	}
+	if c.VolumeWindowInterval != 0 {
+		opts = append(opts, WithRequestVolumeWindow(c.VolumeWindowInterval, c.VolumeWindowBuckets))
+	}
+	if c.HalfOpenSuccessRatio != 0 {
+		opts = append(opts, WithHalfOpenSuccessRatio(c.HalfOpenSuccessRatio, c.HalfOpenMinRequests))
+	}
+	if c.OpenSampling != 0 {
+		opts = append(opts, WithOpenSampling(c.OpenSampling))
+	}
+	if len(c.RampUp) != 0 {
+		opts = append(opts, WithRampUp(c.RampUp...))
+	}
+	if c.RecoveryConfirmWindow != 0 {
+		opts = append(opts, WithRecoveryConfirmWindow(c.RecoveryConfirmWindow))
+	}
+	if c.ProbeTimeout != 0 {
+		opts = append(opts, WithProbeTimeout(c.ProbeTimeout))
+	}
+	if c.StaleProbeReset != 0 {
+		opts = append(opts, WithStaleProbeReset(c.StaleProbeReset))
+	}
+	if c.HalfOpenSuccessSpread != 0 {
+		opts = append(opts, WithHalfOpenSuccessSpread(c.HalfOpenSuccessSpread))
+	}
+	if c.HalfOpenSuccessDecay != 0 {
+		opts = append(opts, WithHalfOpenSuccessDecay(c.HalfOpenSuccessDecay))
+	}
+	if c.HalfOpenQueue != 0 {
+		opts = append(opts, WithHalfOpenQueue(c.HalfOpenQueue))
+	}
+	if c.MaxConcurrency != 0 {
+		opts = append(opts, WithMaxConcurrency(c.MaxConcurrency))
+	}
+	if c.FailedProbeBackoffFactor != 0 {
+		opts = append(opts, WithFailedProbeBackoff(c.FailedProbeBackoffFactor, c.FailedProbeBackoffMax))
+	}
+	if c.MaxOpenDuration != 0 {
+		opts = append(opts, WithMaxOpenDuration(c.MaxOpenDuration))
+	}
+	if c.MaxHalfOpenDuration != 0 {
+		opts = append(opts, WithMaxHalfOpenDuration(c.MaxHalfOpenDuration, c.MaxHalfOpenClose))
+	}
+	if c.CooldownAfterClose != 0 {
+		opts = append(opts, WithCooldownAfterClose(c.CooldownAfterClose))
+	}
+	if c.StartupGracePeriod != 0 {
+		opts = append(opts, WithStartupGracePeriod(c.StartupGracePeriod))
+	}
+	if c.MinimumClosedDuration != 0 {
+		opts = append(opts, WithMinimumClosedDuration(c.MinimumClosedDuration, c.MinimumClosedForgiveness))
+	}
+	if c.RecentErrors != 0 {
+		opts = append(opts, WithRecentErrors(c.RecentErrors))
+	}
+	if c.SlowCallDuration != 0 {
+		opts = append(opts, WithTripOnConsecutiveSlowCalls(c.SlowCallDuration, c.SlowCallCount))
+	}
+	if c.SlowCallPercentile != 0 {
+		opts = append(opts, WithPercentileSlowCalls(c.SlowCallPercentile, c.SlowCallMultiplier, c.SlowCallCount))
+	}
+	if c.IgnoreIsolatedFailures {
+		opts = append(opts, WithIgnoreIsolatedFailures())
+	}
+	if c.ResetFailuresOnSuccess != nil {
+		opts = append(opts, WithResetFailuresOnSuccess(*c.ResetFailuresOnSuccess))
+	}
+	if c.BatchAggregation != 0 {
+		opts = append(opts, WithBatchAggregation(c.BatchAggregation))
+	}
+	if c.OutcomeFunc != nil {
+		opts = append(opts, WithOutcomeFunc(c.OutcomeFunc))
+	}
+	if c.AdmissionPolicy != nil {
+		opts = append(opts, WithAdmissionPolicy(c.AdmissionPolicy))
+	}
+	if c.TransitionStrategy != nil {
+		opts = append(opts, WithTransitionStrategy(c.TransitionStrategy))
+	}
+	return opts
+}
+
+// NewFromConfig 校验配置并创建名为name的熔断器
+func NewFromConfig(name string, c Config) (*CircuitBreaker, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	opts := append([]Option{WithName(name)}, c.Options()...)
+	return NewCircuitBreaker(c.OpenInterval, c.Threshold, opts...), nil
+}
+
+// Options 返回熔断器实际生效的配置，包括默认值以及被忽略的非法Option之后的结果，用于排查熔断器是否按预期配置
+// 返回的是创建时确定的配置的副本，可以随时调用。WithOnStateChange、WithObserver等回调类的配置不包含在内，
+// 默认的放行策略对应AdmissionPolicy为nil
+func (cb *CircuitBreaker) Options() Config {
+	c := Config{
+		OpenInterval:             cb.openInterval,
+		Threshold:                cb.threshold,
+		SoftThreshold:            cb.softThreshold,
+		SheddingCurve:            cb.sheddingCurve,
+		SaturationRatio:          cb.saturationRatio,
+		SaturationFactor:         cb.saturationFactor,
+		LateSuccessStep:          cb.lateSuccessStep,
+		FailureRatio:             cb.failureRatio,
+		MinRequests:              cb.minRequests,
+		HalfOpenSuccessRatio:     cb.halfOpenSuccessRatio,
+		HalfOpenMinRequests:      cb.halfOpenMinRequests,
+		RecoveryConfirmWindow:    time.Duration(cb.confirmWindow) * time.Second,
+		OpenSampling:             cb.openSampling,
+		RampUp:                   append([]float64(nil), cb.rampUp...),
+		ProbeTimeout:             cb.probeTimeout,
+		StaleProbeReset:          time.Duration(cb.staleProbeReset) * time.Second,
+		HalfOpenSuccessSpread:    cb.successSpread,
+		HalfOpenSuccessDecay:     time.Duration(cb.successDecay) * time.Second,
+		HalfOpenQueue:            cb.halfOpenQueue,
+		MaxConcurrency:           uint32(cb.maxConcurrency),
+		FailedProbeBackoffFactor: cb.probeBackoffFactor,
+		FailedProbeBackoffMax:    cb.probeBackoffMax,
+		MaxOpenDuration:          time.Duration(cb.maxOpenDuration) * time.Second,
+		MaxHalfOpenDuration:      time.Duration(cb.maxHalfOpenDuration) * time.Second,
+		MaxHalfOpenClose:         cb.maxHalfOpenClose,
+		CooldownAfterClose:       cb.cooldownCredit,
+		StartupGracePeriod:       time.Duration(cb.startupGrace) * time.Second,
+		MinimumClosedDuration:    time.Duration(cb.minClosedDuration) * time.Second,
+		MinimumClosedForgiveness: cb.closedForgiveness,
+		SlowCallDuration:         cb.slowCallDuration,
+		SlowCallCount:            cb.slowCallCount,
+		RecentErrors:             len(cb.recent.errs),
+		IgnoreIsolatedFailures:   cb.ignoreIsolatedFailures,
+		BatchAggregation:         cb.batchAggregation,
+		OutcomeFunc:              cb.outcome,
+		TransitionStrategy:       cb.strategy,
+	}
+	if cb.window != nil {
+		c.WindowInterval = cb.window.interval
+		c.WindowBuckets = len(cb.window.buckets)
+	}
+	if cb.volume != nil {
+		c.VolumeWindowInterval = cb.volume.interval
+		c.VolumeWindowBuckets = len(cb.volume.buckets)
+	}
+	if cb.observationWeight > 1 {
+		c.ObservationSampling = 1 / float64(cb.observationWeight)
+	}
+	if cb.latency != nil {
+		c.SlowCallDuration = 0
+		c.SlowCallPercentile = cb.latency.percentile
+		c.SlowCallMultiplier = cb.latency.multiplier
+	}
+	reset := cb.resetFailuresOnSuccess
+	c.ResetFailuresOnSuccess = &reset
+	if _, ok := cb.policy.(*defaultAdmissionPolicy); !ok {
+		c.AdmissionPolicy = cb.policy
+	}
+	return c
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigValidate(t *testing.T) {
+	cases := []struct {
+		name string
+		c    Config
+		want string
+	}{
+		{"zero", Config{}, ""},
+		{"full", Config{OpenInterval: 30, Threshold: 10, SoftThreshold: 5, WindowInterval: 10, WindowBuckets: 6, SaturationRatio: 0.5, SaturationFactor: 2}, ""},
+		{"negative interval", Config{OpenInterval: -1}, "OpenInterval"},
+		{"soft above default threshold", Config{SoftThreshold: 5}, "SoftThreshold must be less than Threshold"},
+		{"soft above threshold", Config{Threshold: 3, SoftThreshold: 4}, "SoftThreshold must be less than Threshold"},
+		{"curve without soft", Config{SheddingCurve: LinearShedding}, "SheddingCurve"},
+		{"soft with policy", Config{SoftThreshold: 1, AdmissionPolicy: &defaultAdmissionPolicy{}}, "AdmissionPolicy"},
+		{"window interval only", Config{WindowInterval: 10}, "set together"},
+		{"window buckets only", Config{WindowBuckets: 10}, "set together"},
+		{"ratio out of range", Config{SaturationRatio: 1.5, SaturationFactor: 2}, "SaturationRatio"},
+		{"ratio without factor", Config{SaturationRatio: 0.5}, "SaturationFactor"},
+		{"negative late success step", Config{LateSuccessStep: -1}, "LateSuccessStep"},
+		{"failure ratio out of range", Config{FailureRatio: 2}, "FailureRatio"},
+		{"min requests without ratio", Config{MinRequests: 10}, "MinRequests requires FailureRatio"},
+		{"volume window without ratio", Config{VolumeWindowInterval: 10, VolumeWindowBuckets: 6}, "VolumeWindowInterval requires FailureRatio"},
+		{"volume window buckets only", Config{FailureRatio: 0.5, VolumeWindowBuckets: 6}, "set together"},
+		{"slow call percentile", Config{SlowCallPercentile: 0.5, SlowCallMultiplier: 3, SlowCallCount: 5}, ""},
+		{"slow call percentile without count", Config{SlowCallPercentile: 0.5, SlowCallMultiplier: 3}, "SlowCallCount"},
+		{"slow call duration and percentile", Config{SlowCallDuration: time.Second, SlowCallPercentile: 0.5, SlowCallMultiplier: 3, SlowCallCount: 5}, "mutually exclusive"},
+		{"strategy", Config{TransitionStrategy: twoStateStrategy{}, SlowCallDuration: time.Second, SlowCallCount: 3}, ""},
+		{"window with strategy", Config{TransitionStrategy: twoStateStrategy{}, WindowInterval: 10, WindowBuckets: 6}, "WindowInterval has no effect with a custom TransitionStrategy"},
+		{"probe timeout with strategy", Config{TransitionStrategy: twoStateStrategy{}, ProbeTimeout: 5}, "ProbeTimeout has no effect"},
+		{"isolated failures with strategy", Config{TransitionStrategy: twoStateStrategy{}, IgnoreIsolatedFailures: true}, "IgnoreIsolatedFailures has no effect"},
+	}
+	for _, c := range cases {
+		err := c.c.Validate()
+		if c.want == "" {
+			if err != nil {
+				t.Fatal(c.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Fatal(c.name, err)
+		}
+	}
+
+	// 多个错误同时返回
+	err := Config{OpenInterval: -1, WindowBuckets: 1}.Validate()
+	if err == nil || !strings.Contains(err.Error(), "OpenInterval") || !strings.Contains(err.Error(), "WindowBuckets") {
+		t.Fatal(err)
+	}
+}
+
+func TestNewFromConfig(t *testing.T) {
+	if _, err := NewFromConfig("invalid", Config{Threshold: 2, SoftThreshold: 2}); err == nil {
+		t.Fatal("expect error")
+	}
+	profile := Config{OpenInterval: 30, Threshold: 3, WindowInterval: 10, WindowBuckets: 6}
+	for _, name := range []string{"payments", "orders"} {
+		cb, err := NewFromConfig(name, profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cb.Name() != name || cb.openInterval != 30 || cb.threshold != 3 || cb.window == nil {
+			t.Fatal(cb.Name(), cb.openInterval, cb.threshold, cb.window)
+		}
+	}
+	cb, _ := NewFromConfig("default", Config{})
+	if cb.openInterval != loadDefaultOpenInterval() || cb.threshold != loadDefaultThreshold() {
+		t.Fatal(cb.openInterval, cb.threshold)
+	}
+}
+
+func TestCircuitBreakerOptions(t *testing.T) {
+	cb := NewCircuitBreaker(0, 10,
+		WithBucketedWindow(10, 6),
+		WithFailureRatio(0.5, 20),
+		WithProbeTimeout(-1), // 非法值被忽略
+		WithMaxOpenDuration(5*time.Minute),
+	)
+	c := cb.Options()
+	if c.OpenInterval != 60 || c.Threshold != 10 || c.WindowInterval != 10 || c.WindowBuckets != 6 ||
+		c.FailureRatio != 0.5 || c.MinRequests != 20 || c.ProbeTimeout != 0 || c.MaxOpenDuration != 5*time.Minute {
+		t.Fatalf("%+v", c)
+	}
+	// 配置了滑动窗口时默认不清零连续失败数
+	if c.ResetFailuresOnSuccess == nil || *c.ResetFailuresOnSuccess || c.AdmissionPolicy != nil {
+		t.Fatalf("%+v", c)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	// 返回的配置可以用于创建配置相同的熔断器
+	clone, err := NewFromConfig("clone", c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := clone.Options(); got.WindowBuckets != c.WindowBuckets || got.MaxOpenDuration != c.MaxOpenDuration {
+		t.Fatalf("%+v", got)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import "sync/atomic"
+
+// recover 半开启状态下满足了恢复的条件，未配置confirmWindow时直接关闭熔断器
+// 配置了confirmWindow时第一次满足条件开始确认窗口，窗口内满足条件的成功归还占用的名额，使探测请求继续放行；
+// 窗口内的失败照常重新开启熔断器，窗口结束后由下一次成功或refreshState关闭熔断器
+func (cb *CircuitBreaker) recover(now int64) {
+	if cb.confirmWindow <= 0 {
+		cb.switchState(StateHalfOpen, StateClosed, now, ReasonHalfOpenRecovered)
+		return
+	}
+	confirmAt := atomic.LoadInt64(&cb.confirmAt)
+	if confirmAt != 0 && now >= confirmAt {
+		cb.switchState(StateHalfOpen, StateClosed, now, ReasonHalfOpenRecovered)
+		return
+	}
+	if confirmAt == 0 {
+		atomic.CompareAndSwapInt64(&cb.confirmAt, 0, now+cb.confirmWindow)
+	}
+	cb.release()
+}
+
+// confirmed 半开启状态下的确认窗口是否已经结束
+func (cb *CircuitBreaker) confirmed(now int64) bool {
+	confirmAt := atomic.LoadInt64(&cb.confirmAt)
+	return confirmAt != 0 && now >= confirmAt
+}
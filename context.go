@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// contextKey ExecuteContext在传给f的ctx中保存熔断器信息使用的键
+type contextKey struct{}
+
+// contextValue 放行请求的熔断器名称及放行时所在的周期
+type contextValue struct {
+	name string
+	gen  uint32
+}
+
+// FromContext 返回ExecuteContext放行请求的熔断器名称和放行时所在的周期(参考Stats.Generation)，用于关联下游日志与熔断器的决策
+// ctx不是由ExecuteContext传给f的ctx或其派生时ok为false
+func FromContext(ctx context.Context) (name string, gen uint32, ok bool) {
+	v, ok := ctx.Value(contextKey{}).(contextValue)
+	return v.name, v.gen, ok
+}
+
+// ExecuteContext 与Execute相同，但在ctx已经结束时不执行f，直接返回ctx.Err()
+// ctx在放行判断之前已经结束时不占用半开启状态的探测名额，也不增加请求数；
+// 在放行之后、f执行之前结束时归还占用的名额，不计为一次失败
+// 传给f的ctx由ctx派生，可以通过FromContext读取熔断器的名称和周期
+// f在新的协程中执行，f返回之前ctx结束时ExecuteContext不再等待f，直接返回ctx.Err()，f之后的结果被丢弃：
+// 超过ctx的截止时间(context.DeadlineExceeded)计为一次失败，被调用方取消(context.Canceled)不计为失败并归还占用的名额
+// f应当在ctx结束后尽快返回，避免协程堆积。配置了WithMaxConcurrency时f返回之前一直占用并发名额
+// cb为nil时与Execute相同，直接执行f并返回nil
+func (cb *CircuitBreaker) ExecuteContext(ctx context.Context, f func(ctx context.Context) bool) error {
+	if cb == nil {
+		f(ctx)
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cycle, err := cb.beforeExecute(cb.now())
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		cb.cancel(cycle)
+		cb.leaveConcurrency()
+		return err
+	}
+	fctx := context.WithValue(ctx, contextKey{}, contextValue{name: cb.name, gen: cycle})
+	start := cb.slowStart()
+	done := make(chan [2]bool, 1)
+	go func() {
+		// f返回之前一直占用并发名额，即使ExecuteContext已经因为ctx结束而返回
+		defer cb.leaveConcurrency()
+		success, ignored := cb.invoke(func() bool { return f(fctx) })
+		done <- [2]bool{success, ignored}
+	}()
+	select {
+	case result := <-done:
+		success, ignored := result[0], result[1]
+		if ignored {
+			cb.cancel(cycle)
+			return nil
+		}
+		cb.afterExecute(cycle, success, cb.now())
+		cb.observeLatency(cycle, start, cb.now(), success)
+		return cb.callError(success)
+	case <-ctx.Done():
+		err := ctx.Err()
+		if err == context.DeadlineExceeded {
+			cb.afterExecute(cycle, false, cb.now())
+		} else {
+			cb.cancel(cycle)
+		}
+		return err
+	}
+}
+
+// ExecuteContextErr 与ExecuteContext相同，但f返回error，放行时原样返回f的错误，请求被熔断器拒绝时返回*RejectedError
+// f的错误按以下顺序计入统计：context.Canceled不计入并归还占用的名额，context.DeadlineExceeded计为失败，
+// 其余交给WithOutcomeFunc配置的函数判断(result为nil)，未配置时nil计为成功，否则计为失败
+// ctx在f返回之前结束时的处理与ExecuteContext相同
+func (cb *CircuitBreaker) ExecuteContextErr(ctx context.Context, f func(ctx context.Context) error) error {
+	if cb == nil {
+		return f(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cycle, err := cb.beforeExecute(cb.now())
+	if err != nil {
+		return &RejectedError{Name: cb.name, Err: err}
+	}
+	if err := ctx.Err(); err != nil {
+		cb.cancel(cycle)
+		cb.leaveConcurrency()
+		return err
+	}
+	fctx := context.WithValue(ctx, contextKey{}, contextValue{name: cb.name, gen: cycle})
+	start := cb.slowStart()
+	done := make(chan error, 1)
+	go func() {
+		defer cb.leaveConcurrency()
+		done <- f(fctx)
+	}()
+	select {
+	case err := <-done:
+		var outcome Outcome
+		switch {
+		case errors.Is(err, context.Canceled):
+			outcome = OutcomeIgnore
+		case errors.Is(err, context.DeadlineExceeded):
+			outcome = OutcomeFailure
+		default:
+			outcome = cb.classify(nil, err)
+		}
+		if outcome == OutcomeIgnore {
+			cb.cancel(cycle)
+			return err
+		}
+		success := outcome == OutcomeSuccess
+		if !success {
+			cb.recordError(err)
+		}
+		cb.afterExecute(cycle, success, cb.now())
+		cb.observeLatency(cycle, start, cb.now(), success)
+		return err
+	case <-ctx.Done():
+		err := ctx.Err()
+		if err == context.DeadlineExceeded {
+			cb.recordError(err)
+			cb.afterExecute(cycle, false, cb.now())
+		} else {
+			cb.cancel(cycle)
+		}
+		return err
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// cancelPolicy 放行关闭状态下的请求时结束ctx，模拟ctx在放行之后、f执行之前结束
+type cancelPolicy struct {
+	AdmissionPolicy
+	cancel context.CancelFunc
+}
+
+func (p cancelPolicy) AdmitClosed(counts Counts) bool {
+	p.cancel()
+	return true
+}
+
+func TestCircuitBreakerExecuteContextCancelledBeforeAdmission(t *testing.T) {
+	cb := NewCircuitBreaker(60, 1)
+	DriveToHalfOpen(cb)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	called := false
+	if err := cb.ExecuteContext(ctx, func(context.Context) bool { called = true; return true }); err != context.Canceled {
+		t.Fatal(err)
+	}
+	if called || cb.Counts().Requests != 0 {
+		t.Fatal(called, cb.Counts())
+	}
+	// 探测名额没有被占用
+	if err := cb.ExecuteContext(context.Background(), func(context.Context) bool { return true }); err != nil {
+		t.Fatal(err)
+	}
+	RequireState(t, cb, StateClosed)
+}
+
+func TestCircuitBreakerExecuteContextCancelledAfterAdmission(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cb := NewCircuitBreaker(60, 1, WithAdmissionPolicy(cancelPolicy{
+		AdmissionPolicy: &defaultAdmissionPolicy{threshold: 1},
+		cancel:          cancel,
+	}))
+	called := false
+	if err := cb.ExecuteContext(ctx, func(context.Context) bool { called = true; return false }); err != context.Canceled {
+		t.Fatal(err)
+	}
+	if called || cb.Counts() != (Counts{}) || cb.Metrics().Failures != 0 {
+		t.Fatal(called, cb.Counts())
+	}
+	RequireState(t, cb, StateClosed)
+}
+
+func TestFromContext(t *testing.T) {
+	if _, _, ok := FromContext(context.Background()); ok {
+		t.Fatal(ok)
+	}
+	cb := NewCircuitBreaker(60, 1, WithName("payments"))
+	DriveToHalfOpen(cb)
+	gen := cb.SnapshotStats().Generation
+	err := cb.ExecuteContext(context.Background(), func(ctx context.Context) bool {
+		name, g, ok := FromContext(ctx)
+		if !ok || name != "payments" || g != gen {
+			t.Fatal(name, g, ok)
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCircuitBreakerExecuteContextDeadlineExceeded(t *testing.T) {
+	cb := NewCircuitBreaker(60, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := cb.ExecuteContext(ctx, func(ctx context.Context) bool {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		return true
+	})
+	if err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+	RequireState(t, cb, StateOpen)
+	if cb.Metrics().Failures != 1 {
+		t.Fatal(cb.Metrics())
+	}
+}
+
+func TestCircuitBreakerExecuteContextCanceled(t *testing.T) {
+	cb := NewCircuitBreaker(60, 1)
+	DriveToHalfOpen(cb)
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	go func() {
+		<-started
+		cancel()
+	}()
+	err := cb.ExecuteContext(ctx, func(ctx context.Context) bool {
+		close(started)
+		<-ctx.Done()
+		return false
+	})
+	if err != context.Canceled {
+		t.Fatal(err)
+	}
+	// 不计为失败，并且归还了探测名额
+	RequireState(t, cb, StateHalfOpen)
+	if cb.Counts().Requests != 0 {
+		t.Fatal(cb.Counts())
+	}
+}
+
+func TestCircuitBreakerExecuteContextErr(t *testing.T) {
+	errNotFound := errors.New("not found")
+	errDown := errors.New("down")
+	cb := NewCircuitBreaker(60, 2, WithName("users"), WithOutcomeFunc(func(result interface{}, err error) Outcome {
+		if errors.Is(err, errNotFound) {
+			return OutcomeSuccess
+		}
+		if err != nil {
+			return OutcomeFailure
+		}
+		return OutcomeSuccess
+	}))
+	ctx := context.Background()
+	// 业务错误原样返回，按WithOutcomeFunc计入
+	if err := cb.ExecuteContextErr(ctx, func(context.Context) error { return errNotFound }); err != errNotFound {
+		t.Fatal(err)
+	}
+	if err := cb.ExecuteContextErr(ctx, func(context.Context) error { return errDown }); err != errDown {
+		t.Fatal(err)
+	}
+	if c := cb.Counts(); c.Successes != 1 || c.Failures != 1 || cb.LastError() != errDown {
+		t.Fatal(c, cb.LastError())
+	}
+	// f自己返回的取消不计入
+	if err := cb.ExecuteContextErr(ctx, func(context.Context) error { return context.Canceled }); err != context.Canceled {
+		t.Fatal(err)
+	}
+	if c := cb.Counts(); c.Requests != 2 {
+		t.Fatal(c)
+	}
+	// 调用方在f返回之前取消，不计为失败
+	cctx, cancel := context.WithCancel(ctx)
+	err := cb.ExecuteContextErr(cctx, func(ctx context.Context) error {
+		cancel()
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+	if err != context.Canceled || cb.Counts().Requests != 2 {
+		t.Fatal(err, cb.Counts())
+	}
+	// 超过截止时间计为失败
+	dctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	err = cb.ExecuteContextErr(dctx, func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+	if err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+	RequireState(t, cb, StateOpen)
+	// 拒绝时返回RejectedError
+	called := false
+	err = cb.ExecuteContextErr(ctx, func(context.Context) error {
+		called = true
+		return nil
+	})
+	var rejected *RejectedError
+	if called || !errors.Is(err, ErrOpenState) || !errors.As(err, &rejected) || rejected.Name != "users" {
+		t.Fatal(called, err)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// ExecuteWithDeadline 与Execute相同，但请求共享一个截止时间，f收到距离deadline剩余的时间，可以据此调整行为(例如剩余时间不足时跳过重试)
+// deadline在放行判断之前或放行之后、f执行之前已经过去时不执行f，直接返回context.DeadlineExceeded，不计为一次失败，也不占用探测名额；
+// f返回时已经过了deadline则无论f的结果如何都计为一次失败，并返回context.DeadlineExceeded
+// 剩余时间按熔断器的时钟计算，参考WithClock
+func (cb *CircuitBreaker) ExecuteWithDeadline(deadline time.Time, f func(remaining time.Duration) bool) error {
+	if cb.remaining(deadline) <= 0 {
+		return context.DeadlineExceeded
+	}
+	cycle, err := cb.beforeExecute(cb.now())
+	if err != nil {
+		return err
+	}
+	defer cb.leaveConcurrency()
+	remaining := cb.remaining(deadline)
+	if remaining <= 0 {
+		cb.cancel(cycle)
+		return context.DeadlineExceeded
+	}
+	start := cb.slowStart()
+	success, ignored := cb.invoke(func() bool { return f(remaining) })
+	missed := cb.remaining(deadline) <= 0
+	if ignored && !missed {
+		cb.cancel(cycle)
+		return nil
+	}
+	cb.afterExecute(cycle, success && !missed, cb.now())
+	cb.observeLatency(cycle, start, cb.now(), success && !missed)
+	if missed {
+		return context.DeadlineExceeded
+	}
+	return cb.callError(success)
+}
+
+// remaining 按熔断器的时钟返回距离deadline剩余的时间
+func (cb *CircuitBreaker) remaining(deadline time.Time) time.Duration {
+	return deadline.Sub(cb.epoch) - cb.since(cb.epoch)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerExecuteWithDeadline(t *testing.T) {
+	cb := NewCircuitBreaker(60, 1)
+	called := false
+	err := cb.ExecuteWithDeadline(time.Now().Add(-time.Second), func(remaining time.Duration) bool {
+		called = true
+		return true
+	})
+	// 已经过了截止时间，不执行f，也不计为失败
+	if err != context.DeadlineExceeded || called || cb.Counts() != (Counts{}) {
+		t.Fatal(err, called, cb.Counts())
+	}
+	RequireState(t, cb, StateClosed)
+
+	err = cb.ExecuteWithDeadline(time.Now().Add(time.Minute), func(remaining time.Duration) bool {
+		if remaining <= 59*time.Second || remaining > time.Minute {
+			t.Fatal(remaining)
+		}
+		return true
+	})
+	if err != nil || cb.Counts().Successes != 1 {
+		t.Fatal(err, cb.Counts())
+	}
+
+	// f成功但超过了截止时间，计为失败
+	err = cb.ExecuteWithDeadline(time.Now().Add(time.Second), func(remaining time.Duration) bool {
+		advance(cb, 2*time.Second)
+		return true
+	})
+	if err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+	RequireState(t, cb, StateOpen)
+}
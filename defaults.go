@@ -0,0 +1,57 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// 以下默认值是进程级别的，在NewCircuitBreaker创建熔断器时读取，修改后只影响之后创建的熔断器
+var (
+	defaultOpenInterval int64  = 60
+	defaultThreshold    uint32 = 5
+
+	defaultOptionsMu sync.RWMutex
+	defaultOptions   []Option
+)
+
+// SetDefaultOpenInterval 设置NewCircuitBreaker的openInterval小于等于0时使用的默认值，interval小于等于0时忽略
+// 该设置是进程级别的，建议在init中调用
+func SetDefaultOpenInterval(interval int64) {
+	if interval <= 0 {
+		return
+	}
+	atomic.StoreInt64(&defaultOpenInterval, interval)
+}
+
+// SetDefaultThreshold 设置NewCircuitBreaker的threshold为0时使用的默认值，threshold为0时忽略
+// 该设置是进程级别的，建议在init中调用
+func SetDefaultThreshold(threshold uint32) {
+	if threshold == 0 {
+		return
+	}
+	atomic.StoreUint32(&defaultThreshold, threshold)
+}
+
+// SetDefaultOptions 设置所有熔断器默认应用的Option，它们先于NewCircuitBreaker传入的Option应用，会替换之前设置的默认Option
+// 同一个Option会应用到之后创建的每个熔断器，其中携带的对象被这些熔断器共享，因此默认Option应当是无状态的：
+// WithRand的随机数生成器、WithAdmissionPolicy和WithTransitionStrategy的实现等有状态的对象应在创建每个熔断器时单独传入
+// 该设置是进程级别的，建议在init中调用
+func SetDefaultOptions(opts ...Option) {
+	defaultOptionsMu.Lock()
+	defaultOptions = append([]Option(nil), opts...)
+	defaultOptionsMu.Unlock()
+}
+
+func loadDefaultOpenInterval() int64 {
+	return atomic.LoadInt64(&defaultOpenInterval)
+}
+
+func loadDefaultThreshold() uint32 {
+	return atomic.LoadUint32(&defaultThreshold)
+}
+
+func loadDefaultOptions() []Option {
+	defaultOptionsMu.RLock()
+	defer defaultOptionsMu.RUnlock()
+	return defaultOptions
+}
@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestSetDefaults(t *testing.T) {
+	defer func() {
+		SetDefaultOpenInterval(60)
+		SetDefaultThreshold(5)
+		SetDefaultOptions()
+	}()
+	SetDefaultOpenInterval(30)
+	SetDefaultThreshold(10)
+	SetDefaultOptions(WithName("house"), WithBucketedWindow(10, 6))
+	// 非法值被忽略
+	SetDefaultOpenInterval(-1)
+	SetDefaultThreshold(0)
+
+	cb := NewCircuitBreaker(0, 0)
+	if cb.openInterval != 30 || cb.threshold != 10 || cb.Name() != "house" || cb.window == nil {
+		t.Fatal(cb.openInterval, cb.threshold, cb.Name(), cb.window)
+	}
+	// 显式传入的参数和Option优先
+	cb = NewCircuitBreaker(5, 3, WithName("payments"))
+	if cb.openInterval != 5 || cb.threshold != 3 || cb.Name() != "payments" {
+		t.Fatal(cb.openInterval, cb.threshold, cb.Name())
+	}
+}
+
+func TestCircuitBreakerZeroThreshold(t *testing.T) {
+	defer SetDefaultThreshold(5)
+	SetDefaultThreshold(0)
+	if cb := NewCircuitBreaker(60, 0); cb.Threshold() != 5 {
+		t.Fatal(cb.Threshold())
+	}
+	cb, err := NewFromConfig("payments", Config{Threshold: 0})
+	if err != nil || cb.Threshold() != 5 {
+		t.Fatal(err, cb.Threshold())
+	}
+	// 阈值为1时第一次失败就开启，这是允许的最小值
+	cb = NewCircuitBreaker(60, 1)
+	_ = fail(cb)
+	RequireState(t, cb, StateOpen)
+}
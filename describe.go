@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// StateString 返回状态的名称
+func StateString(state uint32) string {
+	switch state {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// snapshot 熔断器某一时刻的状态和统计数据
+type snapshot struct {
+	state      uint32
+	cycle      uint32
+	counts     Counts
+	openExpire int64
+}
+
+// snapshot 读取熔断器的状态和统计数据，读取期间发生状态切换时重新读取，保证各项数据属于同一个周期
+// 不会触发状态切换
+func (cb *CircuitBreaker) snapshot() snapshot {
+	for {
+		cycle := atomic.LoadUint32(&cb.cycle)
+		snap := snapshot{
+			state:      atomic.LoadUint32(&cb.state),
+			cycle:      cycle,
+			counts:     cb.s.counts(),
+			openExpire: atomic.LoadInt64(&cb.openExpire),
+		}
+		if atomic.LoadUint32(&cb.cycle) == cycle {
+			return snap
+		}
+	}
+}
+
+// Describe 返回熔断器的单行描述，用于日志和管理工具，例如
+// payments: state=open requests=12 consecutiveFailures=5 reopenIn=8s
+// 不会触发状态切换
+func (cb *CircuitBreaker) Describe() string {
+	snap := cb.snapshot()
+	var b strings.Builder
+	if cb.name != "" {
+		b.WriteString(cb.name)
+		b.WriteString(": ")
+	}
+	fmt.Fprintf(&b, "state=%s requests=%d consecutiveSuccesses=%d consecutiveFailures=%d",
+		StateString(snap.state), snap.counts.Requests, snap.counts.ContinuousSuccesses, snap.counts.ContinuousFailures)
+	if snap.state == StateOpen {
+		reopenIn := snap.openExpire - cb.now()
+		if reopenIn < 0 {
+			reopenIn = 0
+		}
+		fmt.Fprintf(&b, " reopenIn=%s", time.Duration(reopenIn)*time.Second)
+	}
+	return b.String()
+}
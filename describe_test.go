@@ -0,0 +1,33 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestCircuitBreakerDescribe(t *testing.T) {
+	cb := NewCircuitBreaker(10, 3, WithName("payments"))
+	_ = success(cb)
+	_ = fail(cb)
+	want := "payments: state=closed requests=2 consecutiveSuccesses=0 consecutiveFailures=1"
+	if got := cb.Describe(); got != want {
+		t.Fatal(got)
+	}
+	_ = fail(cb)
+	_ = fail(cb)
+	pattern := regexp.MustCompile(`^payments: state=open requests=0 consecutiveSuccesses=0 consecutiveFailures=0 reopenIn=(9|10)s$`)
+	if got := cb.Describe(); !pattern.MatchString(got) {
+		t.Fatal(got)
+	}
+
+	cb = NewCircuitBreaker(10, 3)
+	if got := cb.Describe(); got != "state=closed requests=0 consecutiveSuccesses=0 consecutiveFailures=0" {
+		t.Fatal(got)
+	}
+}
+
+func TestStateString(t *testing.T) {
+	if StateString(StateClosed) != "closed" || StateString(StateHalfOpen) != "half-open" || StateString(StateOpen) != "open" || StateString(0) != "unknown" {
+		t.Fatal()
+	}
+}
@@ -0,0 +1,28 @@
+//go:build go1.18
+
+package main
+
+// Do 经过cb的放行判断后执行f，f的结果和错误交给WithOutcomeFunc配置的函数判断计为成功、失败还是不计入，
+// 未配置时err为nil计为成功，否则计为失败。放行时原样返回f的结果和错误，请求被拒绝时返回零值和拒绝的错误
+func Do[T any](cb *CircuitBreaker, f func() (T, error)) (T, error) {
+	cycle, err := cb.beforeExecute(cb.now())
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	defer cb.leaveConcurrency()
+	start := cb.slowStart()
+	v, err := f()
+	switch cb.classify(v, err) {
+	case OutcomeIgnore:
+		cb.cancel(cycle)
+	case OutcomeSuccess:
+		cb.afterExecute(cycle, true, cb.now())
+		cb.observeLatency(cycle, start, cb.now(), true)
+	default:
+		cb.recordError(err)
+		cb.afterExecute(cycle, false, cb.now())
+		cb.observeLatency(cycle, start, cb.now(), false)
+	}
+	return v, err
+}
@@ -0,0 +1,61 @@
+//go:build go1.18
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestDo(t *testing.T) {
+	errDown := errors.New("down")
+	cb := NewCircuitBreaker(60, 2)
+	v, err := Do(cb, func() (int, error) { return 1, nil })
+	if v != 1 || err != nil || cb.Counts().Successes != 1 {
+		t.Fatal(v, err, cb.Counts())
+	}
+	_, _ = Do(cb, func() (int, error) { return 0, errDown })
+	v, err = Do(cb, func() (int, error) { return 2, errDown })
+	if v != 2 || err != errDown {
+		t.Fatal(v, err)
+	}
+	RequireState(t, cb, StateOpen)
+	v, err = Do(cb, func() (int, error) { return 3, nil })
+	if v != 0 || err != ErrOpenState {
+		t.Fatal(v, err)
+	}
+}
+
+func TestDoOutcomeFunc(t *testing.T) {
+	errNotFound := errors.New("not found")
+	cb := NewCircuitBreaker(60, 2, WithOutcomeFunc(func(result interface{}, err error) Outcome {
+		switch {
+		case errors.Is(err, context.Canceled):
+			return OutcomeIgnore
+		case errors.Is(err, errNotFound):
+			return OutcomeSuccess
+		case err == nil && result == "":
+			// 空结果说明下游返回了错误的数据
+			return OutcomeFailure
+		case err != nil:
+			return OutcomeFailure
+		default:
+			return OutcomeSuccess
+		}
+	}))
+	_, err := Do(cb, func() (string, error) { return "", errNotFound })
+	if err != errNotFound || cb.Counts() != (Counts{Requests: 1, ContinuousSuccesses: 1, Successes: 1}) {
+		t.Fatal(err, cb.Counts())
+	}
+	for i := 0; i < 5; i++ {
+		_, _ = Do(cb, func() (string, error) { return "", context.Canceled })
+	}
+	if cb.Counts() != (Counts{Requests: 1, ContinuousSuccesses: 1, Successes: 1}) {
+		t.Fatal(cb.Counts())
+	}
+	_, _ = Do(cb, func() (string, error) { return "", nil })
+	RequireState(t, cb, StateClosed)
+	_, _ = Do(cb, func() (string, error) { return "", nil })
+	RequireState(t, cb, StateOpen)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// dwell 每个状态累计持续的时间
+type dwell struct {
+	mu    sync.Mutex
+	total map[uint32]int64
+	since int64 // 当前状态尚未计入total的时间段的起点
+}
+
+// leave 熔断器在now离开state时，将state持续的时间计入total
+func (d *dwell) leave(state uint32, now int64) {
+	d.mu.Lock()
+	if d.total == nil {
+		d.total = make(map[uint32]int64)
+	}
+	d.total[state] += now - d.since
+	d.since = now
+	d.mu.Unlock()
+}
+
+func (d *dwell) reset(now int64) {
+	d.mu.Lock()
+	d.total = nil
+	d.since = now
+	d.mu.Unlock()
+}
+
+// StateDurations 返回自创建(或上一次Reset)以来熔断器在每个状态累计持续的时间，包括当前状态到目前为止的时间，精度为秒
+// 没有进入过的状态不出现在结果中，例如可以用开启状态的时间除以总时间得到熔断器拒绝请求的时间占比。不会触发状态切换
+func (cb *CircuitBreaker) StateDurations() map[uint32]time.Duration {
+	now := cb.now()
+	cb.dwell.mu.Lock()
+	defer cb.dwell.mu.Unlock()
+	durations := make(map[uint32]time.Duration, len(cb.dwell.total)+1)
+	for state, seconds := range cb.dwell.total {
+		durations[state] = time.Duration(seconds) * time.Second
+	}
+	durations[cb.Peek()] += time.Duration(now-cb.dwell.since) * time.Second
+	return durations
+}
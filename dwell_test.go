@@ -0,0 +1,31 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerStateDurations(t *testing.T) {
+	cb := NewCircuitBreaker(10, 1)
+	advance(cb, 100*time.Second)
+	_ = fail(cb)
+	advance(cb, 11*time.Second)
+	RequireState(t, cb, StateHalfOpen)
+	advance(cb, 3*time.Second)
+	_ = fail(cb)
+	advance(cb, 5*time.Second)
+	want := map[uint32]time.Duration{
+		StateClosed:   100 * time.Second,
+		StateOpen:     16 * time.Second, // 11秒以及当前开启状态的5秒
+		StateHalfOpen: 3 * time.Second,
+	}
+	if got := cb.StateDurations(); !reflect.DeepEqual(got, want) {
+		t.Fatal(got)
+	}
+	cb.Reset()
+	advance(cb, 2*time.Second)
+	if got := cb.StateDurations(); !reflect.DeepEqual(got, map[uint32]time.Duration{StateClosed: 2 * time.Second}) {
+		t.Fatal(got)
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+// 扩展代码(例如自定义的执行方式、适配其它框架)应只通过以下方法与熔断器交互，而不是直接访问statistic等内部字段：
+//   - RecordSuccess/RecordFailure 记录一次请求结果，统计和状态切换与Execute完全相同
+//   - Counts 读取当前周期的统计数据
+//   - SnapshotStats 读取状态、周期编号和统计数据的一致快照
+// 这些方法的语义保持稳定，内部的统计方式(计数器、滑动窗口等)发生变化时不会影响扩展代码
+
+// Stats 熔断器某一时刻的只读快照
+type Stats struct {
+	State uint32
+	// Generation 周期编号，每次状态切换或清空统计数据时递增，可用于判断两次快照之间熔断器是否进入了新的周期
+	Generation uint32
+	Counts     Counts
+}
+
+// SnapshotStats 返回熔断器的状态、周期编号和统计数据，三者属于同一个周期，不会触发状态切换
+func (cb *CircuitBreaker) SnapshotStats() Stats {
+	snap := cb.snapshot()
+	return Stats{
+		State:      snap.state,
+		Generation: snap.cycle,
+		Counts:     snap.counts,
+	}
+}
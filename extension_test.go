@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+// callbackAdapter 模拟扩展代码：异步回调的结果只能通过公开的方法告诉熔断器
+type callbackAdapter struct {
+	cb Breaker
+}
+
+func (a *callbackAdapter) done(err error) {
+	if err != nil {
+		a.cb.RecordFailure()
+	} else {
+		a.cb.RecordSuccess()
+	}
+}
+
+func TestCircuitBreakerExtensionSurface(t *testing.T) {
+	cb := NewCircuitBreaker(60, 3)
+	a := &callbackAdapter{cb: cb}
+	before := cb.SnapshotStats()
+	if before.State != StateClosed || before.Counts != (Counts{}) {
+		t.Fatal(before)
+	}
+	a.done(nil)
+	a.done(ErrOpenState)
+	a.done(ErrOpenState)
+	stats := cb.SnapshotStats()
+	want := Counts{ContinuousFailures: 2, Successes: 1, Failures: 2}
+	if stats.State != StateClosed || stats.Generation != before.Generation || stats.Counts != want || cb.Counts() != want {
+		t.Fatal(stats)
+	}
+	a.done(ErrOpenState)
+	stats = cb.SnapshotStats()
+	if stats.State != StateOpen || stats.Generation != before.Generation+1 || stats.Counts != (Counts{}) {
+		t.Fatal(stats)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import "sync/atomic"
+
+// 关闭状态下请求成功是最常见的情况。没有配置任何需要时间或回调的功能时，Execute跳过读取时钟和刷新状态，
+// 只做必要的原子操作；状态或周期发生变化、请求失败时回退到完整的流程
+
+// canFastPath 创建熔断器后判断是否可以使用快速路径，只要配置了任何可能影响关闭状态下成功请求的功能就不使用
+func (cb *CircuitBreaker) canFastPath() bool {
+	policy, ok := cb.policy.(*defaultAdmissionPolicy)
+	return ok && policy.softThreshold == 0 &&
+		cb.window == nil && cb.shared == nil && cb.volume == nil && cb.failureRatio <= 0 &&
+		cb.observer == nil && cb.tap == nil && !cb.timed() &&
+		!cb.ignoreIsolatedFailures && cb.strategy == nil && cb.cooldownCredit == 0 && cb.maxConcurrency == 0
+}
+
+// admitFast 关闭状态下直接放行请求，返回放行时的周期，不处于关闭状态时返回false
+func (cb *CircuitBreaker) admitFast() (uint32, bool) {
+	cycle := atomic.LoadUint32(&cb.cycle)
+	if atomic.LoadUint32(&cb.state) != StateClosed || cb.IsShutdown() {
+		return 0, false
+	}
+	cb.s.request()
+	if atomic.LoadUint32(&cb.cycle) != cycle {
+		// 增加请求数期间状态发生了变化，撤销后走完整的流程
+		cb.release()
+		return 0, false
+	}
+	return cycle, true
+}
+
+// succeedFast 记录关闭状态下的一次成功，周期已经发生变化时返回false，由afterExecute处理
+func (cb *CircuitBreaker) succeedFast(cycle uint32) bool {
+	if atomic.LoadUint32(&cb.cycle) != cycle {
+		return false
+	}
+	atomic.AddUint64(&cb.totalSuccesses, 1)
+	cb.s.success(cb.threshold, cb.resetFailuresOnSuccess)
+	return true
+}
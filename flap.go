@@ -0,0 +1,28 @@
+package main
+
+// 统计状态切换频率使用的滑动窗口：10个时间跨度为60秒的桶，即最近10分钟
+const (
+	flapBucketInterval = 60
+	flapBuckets        = 10
+)
+
+// FlapRate 返回最近10分钟内平均每分钟的状态切换次数，不会触发状态切换
+// 熔断器在开启和半开启之间反复切换说明下游持续不稳定，可以与开启状态分开告警
+func (cb *CircuitBreaker) FlapRate() float64 {
+	return flapRate(cb.flaps.aggregate(cb.now()))
+}
+
+// recordFlap 记录一次状态切换，切换频率从不超过flapThreshold变为超过时调用onFlapping
+func (cb *CircuitBreaker) recordFlap(now int64) {
+	rate := flapRate(cb.flaps.record(now, true))
+	if cb.onFlapping == nil || rate <= cb.flapThreshold {
+		return
+	}
+	if previous := rate - 1.0/flapBuckets; previous <= cb.flapThreshold {
+		cb.dispatch(func() { cb.onFlapping(cb.name, rate) })
+	}
+}
+
+func flapRate(b bucket) float64 {
+	return float64(b.successes) / flapBuckets
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerFlapRate(t *testing.T) {
+	var alerts []float64
+	cb := NewCircuitBreaker(10, 1, WithName("payments"), WithFlapping(0.5, func(name string, rate float64) {
+		if name != "payments" {
+			t.Fatal(name)
+		}
+		alerts = append(alerts, rate)
+	}))
+	if cb.FlapRate() != 0 {
+		t.Fatal(cb.FlapRate())
+	}
+	// 开启和半开启之间反复切换，每轮两次切换
+	last := 0.0
+	for i := 0; i < 5; i++ {
+		DriveToHalfOpen(cb)
+		_ = fail(cb)
+		rate := cb.FlapRate()
+		if rate <= last {
+			t.Fatal(i, rate, last)
+		}
+		last = rate
+	}
+	// 10次切换以及最开始的一次开启
+	if last != 1.1 || len(alerts) != 1 || alerts[0] != 0.6 {
+		t.Fatal(last, alerts)
+	}
+	// 10分钟后移出窗口
+	advance(cb, 11*time.Minute)
+	if cb.FlapRate() != 0 {
+		t.Fatal(cb.FlapRate())
+	}
+}
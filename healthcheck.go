@@ -0,0 +1,18 @@
+package main
+
+import "sync/atomic"
+
+// healthy 半开启状态下当前周期的健康检查是否已经通过，尚未检查时执行一次检查，检查失败时重新开启熔断器
+// 并发的成功可能同时执行检查，任意一次通过即记为当前周期已经通过
+func (cb *CircuitBreaker) healthy(now int64) bool {
+	cycle := atomic.LoadUint32(&cb.cycle)
+	if atomic.LoadUint32(&cb.healthyCycle) == cycle {
+		return true
+	}
+	if !cb.healthCheck() {
+		cb.switchState(StateHalfOpen, StateOpen, now, ReasonHealthCheck)
+		return false
+	}
+	atomic.StoreUint32(&cb.healthyCycle, cycle)
+	return true
+}
@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestCircuitBreakerBaselineHealthCheck(t *testing.T) {
+	healthy := false
+	checks := 0
+	var reasons []Reason
+	cb := NewCircuitBreaker(10, 2, WithBaselineHealthCheck(func() bool {
+		checks++
+		return healthy
+	}), WithOnStateChange(func(name string, from, to uint32, reason Reason, counts Counts) {
+		reasons = append(reasons, reason)
+	}))
+	DriveToHalfOpen(cb)
+	if checks != 0 {
+		t.Fatal(checks)
+	}
+	// 探测请求成功，但健康检查失败，熔断器重新开启
+	_ = success(cb)
+	RequireState(t, cb, StateOpen)
+	if checks != 1 || reasons[len(reasons)-1] != ReasonHealthCheck || cb.OpenCause() != CauseBackoff {
+		t.Fatal(checks, reasons, cb.OpenCause())
+	}
+
+	healthy = true
+	DriveToHalfOpen(cb)
+	_ = success(cb)
+	RequireState(t, cb, StateHalfOpen)
+	_ = success(cb)
+	RequireState(t, cb, StateClosed)
+	// 每个半开启周期只检查一次
+	if checks != 2 {
+		t.Fatal(checks)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import "time"
+
+// hedgeResult 一次尝试的结果
+type hedgeResult struct {
+	success bool
+	ignored bool
+}
+
+// ExecuteHedged 与Execute相同，但f执行超过hedgeDelay仍未返回时再并发执行一次f作为备份请求，以先成功的一次为准，用于降低长尾耗时
+// 两次尝试合起来只占用一次放行名额，也只记录一次结果：任意一次成功即记为成功并立即返回，不再等待另一次；
+// 全部失败时记为失败，全部被WithErrorPredicate忽略时撤销本次请求。提前返回后仍在执行的尝试在后台结束，结果被丢弃
+// 第一次尝试在hedgeDelay之前失败时直接返回，不再发出备份请求
+// 只在关闭状态下发出备份请求：放行后熔断器已经切换状态或进入新的周期时不再发出，半开启状态下的探测请求也不会发出备份请求
+// f会被并发执行两次，需要能够安全地重复执行。hedgeDelay小于等于0时不发出备份请求
+// 配置了WithMaxConcurrency时备份请求需要单独占用一个并发名额，名额已满时不发出；每次尝试在f返回时归还名额
+func (cb *CircuitBreaker) ExecuteHedged(hedgeDelay time.Duration, f func() bool) error {
+	cycle, err := cb.beforeExecute(cb.now())
+	if err != nil {
+		return err
+	}
+	start := cb.slowStart()
+	results := make(chan hedgeResult, 2)
+	attempt := func() {
+		// 每次尝试在f返回之前一直占用一个并发名额，提前返回后仍在执行的尝试同样占用
+		defer cb.leaveConcurrency()
+		success, ignored := cb.invoke(f)
+		results <- hedgeResult{success: success, ignored: ignored}
+	}
+	go attempt()
+
+	var hedge <-chan time.Time
+	if hedgeDelay > 0 {
+		timer := time.NewTimer(hedgeDelay)
+		defer timer.Stop()
+		hedge = timer.C
+	}
+	attempts, done := 1, 0
+	success, failed := false, false
+	for !success && done < attempts {
+		select {
+		case r := <-results:
+			done++
+			success = r.success
+			failed = failed || !r.success && !r.ignored
+		case <-hedge:
+			if done == 0 && cb.hedgeAllowed(cycle) && cb.enterConcurrency() {
+				attempts++
+				go attempt()
+			}
+		}
+	}
+	if !success && !failed {
+		cb.cancel(cycle)
+		return nil
+	}
+	cb.afterExecute(cycle, success, cb.now())
+	cb.observeLatency(cycle, start, cb.now(), success)
+	return cb.callError(success)
+}
+
+// hedgeAllowed 熔断器仍处于放行请求时的周期并且处于关闭状态时允许发出备份请求
+func (cb *CircuitBreaker) hedgeAllowed(cycle uint32) bool {
+	if cb.IsShutdown() {
+		return false
+	}
+	state, current := cb.refreshState(cb.now())
+	return state == StateClosed && current == cycle
+}
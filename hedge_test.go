@@ -0,0 +1,68 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerExecuteHedged(t *testing.T) {
+	cb := NewCircuitBreaker(60, 3)
+	var calls int32
+	// 第一次尝试很慢，备份请求很快成功
+	f := func() bool {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			time.Sleep(time.Second)
+		}
+		return true
+	}
+	begin := time.Now()
+	if err := cb.ExecuteHedged(10*time.Millisecond, f); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(begin); elapsed > 500*time.Millisecond {
+		t.Fatal("returned after the slow attempt", elapsed)
+	}
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Fatal(calls)
+	}
+	// 两次尝试只记录一次结果
+	if counts := cb.Counts(); counts.Requests != 1 || counts.Successes != 1 || counts.Failures != 0 {
+		t.Fatal(counts)
+	}
+
+	// 第一次尝试在hedgeDelay之前返回时不发出备份请求
+	atomic.StoreInt32(&calls, 1)
+	if err := cb.ExecuteHedged(time.Second, func() bool {
+		atomic.AddInt32(&calls, 1)
+		return false
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&calls) != 2 || cb.Counts().Failures != 1 {
+		t.Fatal(calls, cb.Counts())
+	}
+}
+
+func TestCircuitBreakerExecuteHedgedState(t *testing.T) {
+	cb := NewCircuitBreaker(60, 1)
+	DriveToOpen(cb)
+	if err := cb.ExecuteHedged(time.Millisecond, func() bool { return true }); err != ErrOpenState {
+		t.Fatal(err)
+	}
+
+	// 半开启状态下的探测请求不发出备份请求
+	DriveToHalfOpen(cb)
+	var calls int32
+	if err := cb.ExecuteHedged(time.Millisecond, func() bool {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Fatal(calls)
+	}
+	RequireState(t, cb, StateClosed)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 以下是测试熔断器相关代码时使用的辅助函数
+// 本包是main包，无法被其它包导入，因此这些辅助函数没有放在单独的cbtest包中，只能在本包的测试中使用
+
+// RequireState 断言熔断器处于want状态，否则以包含实际状态和统计数据的信息结束测试
+func RequireState(t testing.TB, cb *CircuitBreaker, want uint32) {
+	t.Helper()
+	if got := cb.State(); got != want {
+		t.Fatalf("circuit breaker state is %s, want %s (%s)", StateString(got), StateString(want), cb.Describe())
+	}
+}
+
+// DriveToOpen 连续记录失败直到熔断器开启
+// 熔断器在记录大量失败后仍未开启时(例如处于启动保护期或使用了自定义规则)panic，避免测试卡住
+func DriveToOpen(cb *CircuitBreaker) {
+	// 在uint64中计算，threshold较大时uint32会溢出
+	limit := 100 * (uint64(cb.threshold) + uint64(cb.minRequests) + 1)
+	for i := uint64(0); cb.State() != StateOpen; i++ {
+		if i == limit {
+			panic(fmt.Sprintf("circuit breaker is not open after %d failures (%s)", limit, cb.Describe()))
+		}
+		cb.RecordFailure()
+	}
+}
+
+// DriveToHalfOpen 将熔断器开启后，把熔断器的时钟向后拨动一个开启周期，使其切换到半开启状态
+func DriveToHalfOpen(cb *CircuitBreaker) {
+	DriveToOpen(cb)
+	advance(cb, time.Duration(cb.openInterval+1)*time.Second)
+	cb.State()
+}
+
+// advance 把熔断器的时钟向后拨动d
+func advance(cb *CircuitBreaker, d time.Duration) {
+	since := cb.since
+	cb.since = func(t time.Time) time.Duration {
+		return since(t) + d
+	}
+}
+
+// fatalRecorder 记录Fatalf的调用而不是结束测试
+type fatalRecorder struct {
+	testing.TB
+	msg string
+}
+
+func (r *fatalRecorder) Helper() {}
+
+func (r *fatalRecorder) Fatalf(format string, args ...interface{}) {
+	r.msg = fmt.Sprintf(format, args...)
+}
+
+func TestRequireState(t *testing.T) {
+	cb := NewCircuitBreaker(60, 2, WithName("payments"))
+	RequireState(t, cb, StateClosed)
+	r := &fatalRecorder{TB: t}
+	RequireState(r, cb, StateOpen)
+	if !strings.Contains(r.msg, "state is closed, want open") || !strings.Contains(r.msg, "payments: state=closed") {
+		t.Fatal(r.msg)
+	}
+}
+
+func TestDriveToOpen(t *testing.T) {
+	cb := NewCircuitBreaker(60, 3)
+	DriveToOpen(cb)
+	RequireState(t, cb, StateOpen)
+}
+
+func TestDriveToOpenNeverTrips(t *testing.T) {
+	cb := NewCircuitBreaker(60, 3, WithStartupGracePeriod(time.Hour))
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "not open after 400 failures") {
+			t.Fatal(r)
+		}
+	}()
+	DriveToOpen(cb)
+}
+
+func TestDriveToHalfOpen(t *testing.T) {
+	cb := NewCircuitBreaker(60, 3)
+	DriveToHalfOpen(cb)
+	RequireState(t, cb, StateHalfOpen)
+	for i := 0; i < 3; i++ {
+		if err := success(cb); err != nil {
+			t.Fatal(err)
+		}
+	}
+	RequireState(t, cb, StateClosed)
+}
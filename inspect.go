@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+// Inspection 熔断器的配置和某一时刻运行状态的完整视图，用于管理工具的序列化和比较
+// 所有字段都是值类型，两个Inspection可以直接用==比较。函数和接口类型的配置(SheddingCurve、OutcomeFunc、AdmissionPolicy、TransitionStrategy)
+// 无法序列化和比较：SheddingCurve和OutcomeFunc记录ParseConfig中使用的名称，不是内置曲线或注册的函数时为"custom"，
+// 其余只记录是否配置了自定义的实现；RampUp只记录阶梯数
+// 时间字段与Config相同，以秒为单位的字段为整数秒，time.Duration字段在JSON中为纳秒数
+type Inspection struct {
+	Name string `json:"name"`
+
+	// 运行状态，与SnapshotStats相同，状态、周期和统计数据属于同一个周期
+	State               string        `json:"state"`
+	Generation          uint32        `json:"generation"`
+	Requests            uint32        `json:"requests"`
+	ContinuousSuccesses uint32        `json:"continuousSuccesses"`
+	ContinuousFailures  uint32        `json:"continuousFailures"`
+	Successes           uint32        `json:"successes"`
+	Failures            uint32        `json:"failures"`
+	ContinuousSlowCalls uint32        `json:"continuousSlowCalls"`
+	SlowCallThreshold   time.Duration `json:"slowCallThreshold"`
+	OpenCause           string        `json:"openCause"`
+	ReopenIn            time.Duration `json:"reopenIn"`
+	FailedProbes        uint32        `json:"failedProbes"`
+	Shutdown            bool          `json:"shutdown"`
+
+	// 配置，含义参考Config中的同名字段
+	OpenInterval             int64            `json:"openInterval"`
+	Threshold                uint32           `json:"threshold"`
+	SoftThreshold            uint32           `json:"softThreshold"`
+	SheddingCurve            string           `json:"sheddingCurve"`
+	WindowInterval           int64            `json:"windowInterval"`
+	WindowBuckets            int              `json:"windowBuckets"`
+	SaturationRatio          float64          `json:"saturationRatio"`
+	SaturationFactor         int64            `json:"saturationFactor"`
+	LateSuccessStep          int64            `json:"lateSuccessStep"`
+	FailureRatio             float64          `json:"failureRatio"`
+	MinRequests              uint32           `json:"minRequests"`
+	ObservationSampling      float64          `json:"observationSampling"`
+	VolumeWindowInterval     int64            `json:"volumeWindowInterval"`
+	VolumeWindowBuckets      int              `json:"volumeWindowBuckets"`
+	HalfOpenSuccessRatio     float64          `json:"halfOpenSuccessRatio"`
+	HalfOpenMinRequests      uint32           `json:"halfOpenMinRequests"`
+	RecoveryConfirmWindow    time.Duration    `json:"recoveryConfirmWindow"`
+	OpenSampling             float64          `json:"openSampling"`
+	RampUpSteps              int              `json:"rampUpSteps"`
+	ProbeTimeout             int64            `json:"probeTimeout"`
+	StaleProbeReset          time.Duration    `json:"staleProbeReset"`
+	HalfOpenSuccessSpread    int64            `json:"halfOpenSuccessSpread"`
+	HalfOpenSuccessDecay     time.Duration    `json:"halfOpenSuccessDecay"`
+	HalfOpenQueue            time.Duration    `json:"halfOpenQueue"`
+	MaxConcurrency           uint32           `json:"maxConcurrency"`
+	FailedProbeBackoffFactor int64            `json:"failedProbeBackoffFactor"`
+	FailedProbeBackoffMax    int64            `json:"failedProbeBackoffMax"`
+	MaxOpenDuration          time.Duration    `json:"maxOpenDuration"`
+	MaxHalfOpenDuration      time.Duration    `json:"maxHalfOpenDuration"`
+	MaxHalfOpenClose         bool             `json:"maxHalfOpenClose"`
+	CooldownAfterClose       uint32           `json:"cooldownAfterClose"`
+	StartupGracePeriod       time.Duration    `json:"startupGracePeriod"`
+	MinimumClosedDuration    time.Duration    `json:"minimumClosedDuration"`
+	MinimumClosedForgiveness uint32           `json:"minimumClosedForgiveness"`
+	SlowCallDuration         time.Duration    `json:"slowCallDuration"`
+	SlowCallCount            uint32           `json:"slowCallCount"`
+	SlowCallPercentile       float64          `json:"slowCallPercentile"`
+	SlowCallMultiplier       float64          `json:"slowCallMultiplier"`
+	RecentErrors             int              `json:"recentErrors"`
+	IgnoreIsolatedFailures   bool             `json:"ignoreIsolatedFailures"`
+	ResetFailuresOnSuccess   bool             `json:"resetFailuresOnSuccess"`
+	BatchAggregation         BatchAggregation `json:"batchAggregation"`
+	Classifier               string           `json:"classifier"`
+	CustomAdmissionPolicy    bool             `json:"customAdmissionPolicy"`
+	CustomTransitionStrategy bool             `json:"customTransitionStrategy"`
+}
+
+// Inspect 返回熔断器的配置和当前运行状态，不会触发状态切换
+// 与Counts、Metrics不同，Inspect同时包含配置，适用于管理后台展示以及比较两个熔断器或同一个熔断器前后两次的差异
+func (cb *CircuitBreaker) Inspect() Inspection {
+	snap := cb.snapshot()
+	c := cb.Options()
+	in := Inspection{
+		Name:                cb.name,
+		State:               StateString(snap.state),
+		Generation:          snap.cycle,
+		Requests:            snap.counts.Requests,
+		ContinuousSuccesses: snap.counts.ContinuousSuccesses,
+		ContinuousFailures:  snap.counts.ContinuousFailures,
+		Successes:           snap.counts.Successes,
+		Failures:            snap.counts.Failures,
+		ContinuousSlowCalls: snap.counts.ContinuousSlowCalls,
+		SlowCallThreshold:   cb.SlowCallThreshold(),
+		OpenCause:           CauseNone.String(),
+		FailedProbes:        cb.FailedProbes(),
+		Shutdown:            cb.IsShutdown(),
+
+		OpenInterval:             c.OpenInterval,
+		Threshold:                c.Threshold,
+		SoftThreshold:            c.SoftThreshold,
+		SheddingCurve:            sheddingCurveName(c.SheddingCurve),
+		WindowInterval:           c.WindowInterval,
+		WindowBuckets:            c.WindowBuckets,
+		SaturationRatio:          c.SaturationRatio,
+		SaturationFactor:         c.SaturationFactor,
+		LateSuccessStep:          c.LateSuccessStep,
+		FailureRatio:             c.FailureRatio,
+		MinRequests:              c.MinRequests,
+		ObservationSampling:      c.ObservationSampling,
+		VolumeWindowInterval:     c.VolumeWindowInterval,
+		VolumeWindowBuckets:      c.VolumeWindowBuckets,
+		HalfOpenSuccessRatio:     c.HalfOpenSuccessRatio,
+		HalfOpenMinRequests:      c.HalfOpenMinRequests,
+		RecoveryConfirmWindow:    c.RecoveryConfirmWindow,
+		OpenSampling:             c.OpenSampling,
+		RampUpSteps:              len(c.RampUp),
+		ProbeTimeout:             c.ProbeTimeout,
+		StaleProbeReset:          c.StaleProbeReset,
+		HalfOpenSuccessSpread:    c.HalfOpenSuccessSpread,
+		HalfOpenSuccessDecay:     c.HalfOpenSuccessDecay,
+		HalfOpenQueue:            c.HalfOpenQueue,
+		MaxConcurrency:           c.MaxConcurrency,
+		FailedProbeBackoffFactor: c.FailedProbeBackoffFactor,
+		FailedProbeBackoffMax:    c.FailedProbeBackoffMax,
+		MaxOpenDuration:          c.MaxOpenDuration,
+		MaxHalfOpenDuration:      c.MaxHalfOpenDuration,
+		MaxHalfOpenClose:         c.MaxHalfOpenClose,
+		CooldownAfterClose:       c.CooldownAfterClose,
+		StartupGracePeriod:       c.StartupGracePeriod,
+		MinimumClosedDuration:    c.MinimumClosedDuration,
+		MinimumClosedForgiveness: c.MinimumClosedForgiveness,
+		SlowCallDuration:         c.SlowCallDuration,
+		SlowCallCount:            c.SlowCallCount,
+		SlowCallPercentile:       c.SlowCallPercentile,
+		SlowCallMultiplier:       c.SlowCallMultiplier,
+		RecentErrors:             c.RecentErrors,
+		IgnoreIsolatedFailures:   c.IgnoreIsolatedFailures,
+		ResetFailuresOnSuccess:   *c.ResetFailuresOnSuccess,
+		BatchAggregation:         c.BatchAggregation,
+		Classifier:               classifierName(c.OutcomeFunc),
+		CustomAdmissionPolicy:    c.AdmissionPolicy != nil,
+		CustomTransitionStrategy: c.TransitionStrategy != nil,
+	}
+	if snap.state == StateOpen {
+		in.OpenCause = OpenCause(atomic.LoadUint32(&cb.openCause)).String()
+		if reopenIn := snap.openExpire - cb.now(); reopenIn > 0 {
+			in.ReopenIn = time.Duration(reopenIn) * time.Second
+		}
+	}
+	return in
+}
+
+// sheddingCurveName 返回曲线在sheddingCurves中的名称，未配置时为空字符串，不是内置曲线时为"custom"
+func sheddingCurveName(curve SheddingCurve) string {
+	if curve == nil {
+		return ""
+	}
+	for name, c := range sheddingCurves {
+		if reflect.ValueOf(c).Pointer() == reflect.ValueOf(curve).Pointer() {
+			return name
+		}
+	}
+	return "custom"
+}
+
+// MarshalBreakers 将多个熔断器的Inspect结果序列化为以名称为键的JSON对象，用于一次性导出所有熔断器的状态
+// 每个熔断器的快照各自是一致的，不同熔断器的快照在依次读取的不同时刻生成。熔断器没有名称或名称重复时返回错误
+func MarshalBreakers(breakers ...*CircuitBreaker) ([]byte, error) {
+	inspections := make(map[string]Inspection, len(breakers))
+	for _, cb := range breakers {
+		if cb.name == "" {
+			return nil, errors.New("circuit breaker without a name")
+		}
+		if _, ok := inspections[cb.name]; ok {
+			return nil, fmt.Errorf("duplicate circuit breaker name %q", cb.name)
+		}
+		inspections[cb.name] = cb.Inspect()
+	}
+	return json.Marshal(inspections)
+}
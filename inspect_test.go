@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerInspect(t *testing.T) {
+	cb := NewCircuitBreaker(30, 3, WithName("payments"), WithSoftThreshold(2, nil), WithMaxOpenDuration(time.Minute))
+	in := cb.Inspect()
+	if in.Name != "payments" || in.State != "closed" || in.OpenInterval != 30 || in.Threshold != 3 || in.SoftThreshold != 2 ||
+		in.SheddingCurve != "linear" || in.MaxOpenDuration != time.Minute || !in.ResetFailuresOnSuccess || in.OpenCause != "none" {
+		t.Fatal(in)
+	}
+	if cb.Inspect() != in {
+		t.Fatal(cb.Inspect(), in)
+	}
+
+	_ = fail(cb)
+	_ = success(cb)
+	in = cb.Inspect()
+	if in.Requests != 2 || in.Successes != 1 || in.Failures != 1 {
+		t.Fatal(in)
+	}
+	cb.Trip()
+	in = cb.Inspect()
+	if in.State != "open" || in.OpenCause != "manual" || in.ReopenIn != 30*time.Second || in.Generation != cb.SnapshotStats().Generation {
+		t.Fatal(in)
+	}
+
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Inspection
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded != in {
+		t.Fatal(err, string(data))
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil || fields["state"] != "open" || fields["threshold"] != float64(3) {
+		t.Fatal(err, fields)
+	}
+
+	cb = NewCircuitBreaker(30, 3, WithSoftThreshold(2, func(failures, soft, hard uint32) float64 { return 0 }))
+	if cb.Inspect().SheddingCurve != "custom" {
+		t.Fatal(cb.Inspect())
+	}
+}
+
+func TestMarshalBreakers(t *testing.T) {
+	closed := NewCircuitBreaker(60, 2, WithName("users"))
+	open := NewCircuitBreaker(60, 1, WithName("payments"))
+	_ = fail(open)
+	halfOpen := NewCircuitBreaker(60, 1, WithName("orders"))
+	DriveToHalfOpen(halfOpen)
+	data, err := MarshalBreakers(closed, open, halfOpen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]Inspection
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got["users"].State != "closed" || got["payments"].State != "open" || got["payments"].OpenCause != "failures" ||
+		got["orders"].State != "half-open" || got["orders"].Threshold != 1 {
+		t.Fatal(string(data))
+	}
+
+	if _, err := MarshalBreakers(closed, NewCircuitBreaker(60, 1)); err == nil {
+		t.Fatal(err)
+	}
+	if _, err := MarshalBreakers(closed, NewCircuitBreaker(60, 1, WithName("users"))); err == nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 按百分位检测慢调用时保留的最近请求耗时样本数，以及开始计算阈值所需的最少样本数
+// 每记录latencyRecompute个样本重新计算一次阈值，避免每个请求都排序
+const (
+	latencySamples    = 128
+	latencyMinSamples = 32
+	latencyRecompute  = 16
+)
+
+// latencySampler 关闭状态下最近请求耗时的滚动样本，慢调用阈值为样本中percentile分位的耗时乘以multiplier
+type latencySampler struct {
+	percentile float64
+	multiplier float64
+
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int // 下一个样本写入的位置
+	pending int // 上一次计算阈值之后记录的样本数
+	// threshold 当前的慢调用阈值，样本不足latencyMinSamples时为0
+	threshold int64
+}
+
+func newLatencySampler(percentile, multiplier float64) *latencySampler {
+	return &latencySampler{
+		percentile: percentile,
+		multiplier: multiplier,
+		samples:    make([]time.Duration, 0, latencySamples),
+	}
+}
+
+// record 记录一个样本，样本数足够并且距离上一次计算已经记录了latencyRecompute个样本时重新计算阈值
+func (l *latencySampler) record(elapsed time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.samples) < latencySamples {
+		l.samples = append(l.samples, elapsed)
+	} else {
+		l.samples[l.next] = elapsed
+	}
+	l.next = (l.next + 1) % latencySamples
+	l.pending++
+	if len(l.samples) < latencyMinSamples || l.pending < latencyRecompute && atomic.LoadInt64(&l.threshold) != 0 {
+		return
+	}
+	l.pending = 0
+	sorted := append([]time.Duration(nil), l.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	p := sorted[int(l.percentile*float64(len(sorted)-1))]
+	atomic.StoreInt64(&l.threshold, int64(float64(p)*l.multiplier))
+}
+
+// current 返回当前的慢调用阈值，样本不足时返回0
+func (l *latencySampler) current() time.Duration {
+	return time.Duration(atomic.LoadInt64(&l.threshold))
+}
+
+// SlowCallThreshold 返回当前判断慢调用使用的耗时阈值
+// 配置了WithPercentileSlowCalls时返回按最近的请求耗时计算出的阈值，样本不足时返回0；
+// 配置了WithTripOnConsecutiveSlowCalls时返回固定的阈值；都没有配置时返回0
+func (cb *CircuitBreaker) SlowCallThreshold() time.Duration {
+	if cb.latency != nil {
+		return cb.latency.current()
+	}
+	return cb.slowCallDuration
+}
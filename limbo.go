@@ -0,0 +1,18 @@
+package main
+
+import "sync/atomic"
+
+// detectLimbo 半开启状态持续超过limboTimeout并且仍有探测请求未返回时调用onLimbo，每个周期只调用一次
+func (cb *CircuitBreaker) detectLimbo(now int64) {
+	if now-atomic.LoadInt64(&cb.stateSince) < cb.limboTimeout {
+		return
+	}
+	cycle := atomic.LoadUint32(&cb.cycle)
+	counts := cb.s.counts()
+	if counts.Requests <= counts.Successes+counts.Failures {
+		return
+	}
+	if limbo := atomic.LoadUint32(&cb.limboCycle); limbo != cycle && atomic.CompareAndSwapUint32(&cb.limboCycle, limbo, cycle) {
+		cb.onLimbo(cb.name, counts)
+	}
+}
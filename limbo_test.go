@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerHalfOpenLimbo(t *testing.T) {
+	var got []Counts
+	cb := NewCircuitBreaker(10, 2, WithHalfOpenLimbo(30*time.Second, func(name string, counts Counts) {
+		got = append(got, counts)
+	}))
+	DriveToHalfOpen(cb)
+	// 两个探测请求被调用方丢弃，名额耗尽，熔断器既不关闭也不重新开启
+	for i := 0; i < 2; i++ {
+		if _, err := cb.beforeExecute(cb.now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	advance(cb, 29*time.Second)
+	RequireState(t, cb, StateHalfOpen)
+	if len(got) != 0 {
+		t.Fatal(got)
+	}
+	advance(cb, time.Second)
+	RequireState(t, cb, StateHalfOpen)
+	if len(got) != 1 || got[0].Requests != 2 {
+		t.Fatal(got)
+	}
+	// 每个周期只回调一次
+	advance(cb, time.Minute)
+	_ = success(cb)
+	if len(got) != 1 {
+		t.Fatal(got)
+	}
+
+	// 探测请求都已返回时不是limbo
+	got = nil
+	cb = NewCircuitBreaker(10, 2, WithHalfOpenSuccessSpread(100), WithHalfOpenLimbo(30*time.Second, func(name string, counts Counts) {
+		got = append(got, counts)
+	}))
+	DriveToHalfOpen(cb)
+	_ = success(cb)
+	advance(cb, time.Minute)
+	RequireState(t, cb, StateHalfOpen)
+	if len(got) != 0 {
+		t.Fatal(got)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+// Merge 汇总多个熔断器(例如按分片创建的熔断器)当前周期的统计数据，只读，用于整体的健康状况上报
+// Requests、Successes、Failures按总和汇总；ContinuousSuccesses、ContinuousFailures、ContinuousSlowCalls取各熔断器中的最大值，
+// 即情况最极端的那个分片，连续计数在不同熔断器之间相加没有意义。nil的熔断器被跳过，不会触发任何状态切换
+func Merge(breakers ...*CircuitBreaker) Counts {
+	var merged Counts
+	for _, cb := range breakers {
+		if cb == nil {
+			continue
+		}
+		counts := cb.SnapshotStats().Counts
+		merged.Requests += counts.Requests
+		merged.Successes += counts.Successes
+		merged.Failures += counts.Failures
+		merged.ContinuousSuccesses = maxUint32(merged.ContinuousSuccesses, counts.ContinuousSuccesses)
+		merged.ContinuousFailures = maxUint32(merged.ContinuousFailures, counts.ContinuousFailures)
+		merged.ContinuousSlowCalls = maxUint32(merged.ContinuousSlowCalls, counts.ContinuousSlowCalls)
+	}
+	return merged
+}
+
+// MergeState 返回多个熔断器的汇总状态，状态冲突时取最差的状态：任意一个开启时为StateOpen，
+// 否则任意一个半开启时为StateHalfOpen，全部关闭(或没有熔断器)时为StateClosed
+// 与Peek相同读取保存的状态，不会触发状态切换，nil的熔断器视为关闭
+func MergeState(breakers ...*CircuitBreaker) uint32 {
+	merged := StateClosed
+	for _, cb := range breakers {
+		if cb == nil {
+			continue
+		}
+		switch cb.Peek() {
+		case StateOpen:
+			return StateOpen
+		case StateHalfOpen:
+			merged = StateHalfOpen
+		}
+	}
+	return merged
+}
+
+func maxUint32(a, b uint32) uint32 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestMerge(t *testing.T) {
+	closed := NewCircuitBreaker(60, 5)
+	_ = success(closed)
+	_ = fail(closed)
+	_ = fail(closed)
+	halfOpen := NewCircuitBreaker(60, 3)
+	DriveToHalfOpen(halfOpen)
+	_ = success(halfOpen)
+	open := NewCircuitBreaker(60, 1)
+	_ = fail(open)
+
+	want := Counts{Requests: 4, ContinuousSuccesses: 1, ContinuousFailures: 2, Successes: 2, Failures: 2}
+	if got := Merge(closed, halfOpen, nil); got != want {
+		t.Fatal(got)
+	}
+	if got := MergeState(closed, halfOpen, nil); got != StateHalfOpen {
+		t.Fatal(StateString(got))
+	}
+	if got := MergeState(closed, halfOpen, open); got != StateOpen {
+		t.Fatal(StateString(got))
+	}
+	if got := MergeState(closed); got != StateClosed {
+		t.Fatal(StateString(got))
+	}
+	if Merge() != (Counts{}) || MergeState() != StateClosed {
+		t.Fatal(Merge(), MergeState())
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics 熔断器某一时刻的监控数据，只包含值类型的字段，适合高频采集
+type Metrics struct {
+	State uint32
+	// Successes、Failures、Rejections 自创建以来成功、失败、被拒绝的请求总数
+	Successes  uint64
+	Failures   uint64
+	Rejections uint64
+	// ContinuousSuccesses、ContinuousFailures 当前周期的连续成功数和连续失败数
+	ContinuousSuccesses uint32
+	ContinuousFailures  uint32
+	// TimeInState 处于当前状态的时间，精度为秒
+	TimeInState time.Duration
+}
+
+// Metrics 返回熔断器的监控数据，各字段通过原子操作分别读取，是某一时刻的近似快照，不会触发状态切换，也不会分配内存
+func (cb *CircuitBreaker) Metrics() Metrics {
+	return Metrics{
+		State:               atomic.LoadUint32(&cb.state),
+		Successes:           atomic.LoadUint64(&cb.totalSuccesses),
+		Failures:            atomic.LoadUint64(&cb.totalFailures),
+		Rejections:          atomic.LoadUint64(&cb.totalRejections),
+		ContinuousSuccesses: atomic.LoadUint32(&cb.s.continuousSuccesses),
+		ContinuousFailures:  atomic.LoadUint32(&cb.s.continuousFailures),
+		TimeInState:         time.Duration(cb.now()-atomic.LoadInt64(&cb.stateSince)) * time.Second,
+	}
+}
+
+// DefaultLatencyBuckets LatencyHistogram默认使用的桶上界，单位秒，与Prometheus客户端的默认值相同
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// LatencyHistogram 按熔断器名称和请求结果(success/failure)统计请求耗时分布的直方图，可以同时用于多个熔断器
+// Observe可以直接作为WithLatencyObserver的回调，复用慢调用检测测量的耗时；
+// WritePrometheus按Prometheus的文本格式输出，可以直接挂在/metrics接口上，不需要依赖Prometheus的客户端库
+type LatencyHistogram struct {
+	metric  string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[latencySeries]*LatencyDistribution
+}
+
+// latencySeries 直方图的一组标签
+type latencySeries struct {
+	name    string
+	outcome string
+}
+
+// LatencyDistribution 一组标签下的耗时分布，Counts[i]为耗时不超过Buckets[i]秒的请求数(累计值)
+type LatencyDistribution struct {
+	Buckets []float64
+	Counts  []uint64
+	// Count、Sum 请求总数和总耗时，单位秒
+	Count uint64
+	Sum   float64
+}
+
+// NewLatencyHistogram 创建一个指标名为metric的直方图，buckets为桶的上界，单位秒，为空时使用DefaultLatencyBuckets
+func NewLatencyHistogram(metric string, buckets ...float64) *LatencyHistogram {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &LatencyHistogram{
+		metric:  metric,
+		buckets: buckets,
+		series:  make(map[latencySeries]*LatencyDistribution),
+	}
+}
+
+// Observe 记录名为name的熔断器一次结果为success、耗时为elapsed的请求
+func (h *LatencyHistogram) Observe(name string, success bool, elapsed time.Duration) {
+	key := latencySeries{name: name, outcome: outcomeLabel(success)}
+	seconds := elapsed.Seconds()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	d, ok := h.series[key]
+	if !ok {
+		d = &LatencyDistribution{Buckets: h.buckets, Counts: make([]uint64, len(h.buckets))}
+		h.series[key] = d
+	}
+	for i, le := range h.buckets {
+		if seconds <= le {
+			d.Counts[i]++
+		}
+	}
+	d.Count++
+	d.Sum += seconds
+}
+
+// Distribution 返回名为name的熔断器结果为success的请求的耗时分布，没有记录过时ok为false
+func (h *LatencyHistogram) Distribution(name string, success bool) (d LatencyDistribution, ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[latencySeries{name: name, outcome: outcomeLabel(success)}]
+	if !ok {
+		return LatencyDistribution{}, false
+	}
+	d = *s
+	d.Counts = append([]uint64(nil), s.Counts...)
+	return d, true
+}
+
+// WritePrometheus 按Prometheus的文本格式输出所有标签组合的直方图，标签为name和outcome
+func (h *LatencyHistogram) WritePrometheus(w io.Writer) error {
+	h.mu.Lock()
+	keys := make([]latencySeries, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].name != keys[j].name {
+			return keys[i].name < keys[j].name
+		}
+		return keys[i].outcome < keys[j].outcome
+	})
+	var b strings.Builder
+	fmt.Fprintf(&b, "# HELP %s Duration of calls executed through circuit breakers.\n", h.metric)
+	fmt.Fprintf(&b, "# TYPE %s histogram\n", h.metric)
+	for _, key := range keys {
+		d := h.series[key]
+		labels := fmt.Sprintf(`name="%s",outcome="%s"`, escapeLabel(key.name), key.outcome)
+		for i, le := range d.Buckets {
+			fmt.Fprintf(&b, "%s_bucket{%s,le=\"%s\"} %d\n", h.metric, labels, strconv.FormatFloat(le, 'g', -1, 64), d.Counts[i])
+		}
+		fmt.Fprintf(&b, "%s_bucket{%s,le=\"+Inf\"} %d\n", h.metric, labels, d.Count)
+		fmt.Fprintf(&b, "%s_sum{%s} %s\n", h.metric, labels, strconv.FormatFloat(d.Sum, 'g', -1, 64))
+		fmt.Fprintf(&b, "%s_count{%s} %d\n", h.metric, labels, d.Count)
+	}
+	h.mu.Unlock()
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func outcomeLabel(success bool) string {
+	if success {
+		return "success"
+	}
+	return "failure"
+}
+
+// labelEscaper 按Prometheus文本格式转义标签值中的反斜杠、双引号和换行
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
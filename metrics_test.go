@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerMetrics(t *testing.T) {
+	cb := NewCircuitBreaker(60, 2)
+	_ = success(cb)
+	_ = fail(cb)
+	m := cb.Metrics()
+	want := Metrics{State: StateClosed, Successes: 1, Failures: 1, ContinuousFailures: 1}
+	if m != want {
+		t.Fatal(m)
+	}
+	_ = fail(cb)
+	_ = success(cb)
+	_ = success(cb)
+	advance(cb, 5*time.Second)
+	m = cb.Metrics()
+	// 累计数据不随周期清空
+	want = Metrics{State: StateOpen, Successes: 1, Failures: 2, Rejections: 2, TimeInState: 5 * time.Second}
+	if m != want {
+		t.Fatal(m)
+	}
+}
+
+func BenchmarkMetrics(b *testing.B) {
+	breakers := make([]*CircuitBreaker, 1000)
+	for i := range breakers {
+		breakers[i] = NewCircuitBreaker(60, 5)
+		_ = success(breakers[i])
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, cb := range breakers {
+			_ = cb.Metrics()
+		}
+	}
+}
+
+func BenchmarkExecuteClosedSuccess(b *testing.B) {
+	for _, c := range []struct {
+		name string
+		fast bool
+		opts []Option
+	}{
+		{"fast", true, nil},
+		{"full", false, nil}, // 同样没有配置任何功能，但强制走完整的流程作为对比
+		{"window", false, []Option{WithBucketedWindow(10, 6)}},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			cb := NewCircuitBreaker(60, 5, c.opts...)
+			cb.fastPath = c.fast
+			ok := func() bool { return true }
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_ = cb.Execute(ok)
+			}
+		})
+	}
+}
+
+func TestLatencyHistogram(t *testing.T) {
+	latency := NewLatencyHistogram("circuit_breaker_call_duration_seconds", 0.1, 0.01, 1)
+	cb := NewCircuitBreaker(60, 5, WithName("payments"), WithLatencyObserver(latency.Observe))
+	// 成功和失败的请求分别计入各自的标签
+	_ = cb.Execute(func() bool {
+		time.Sleep(20 * time.Millisecond)
+		return true
+	})
+	_ = success(cb)
+	_ = fail(cb)
+	ok, found := latency.Distribution("payments", true)
+	if !found || ok.Count != 2 || ok.Counts[0] != 1 || ok.Counts[1] != 2 || ok.Counts[2] != 2 || ok.Sum < 0.02 {
+		t.Fatal(ok)
+	}
+	failed, found := latency.Distribution("payments", false)
+	if !found || failed.Count != 1 || failed.Counts[0] != 1 {
+		t.Fatal(failed)
+	}
+	if _, found := latency.Distribution("orders", true); found {
+		t.Fatal("unexpected series")
+	}
+
+	var b strings.Builder
+	if err := latency.WritePrometheus(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, line := range []string{
+		"# TYPE circuit_breaker_call_duration_seconds histogram\n",
+		`circuit_breaker_call_duration_seconds_bucket{name="payments",outcome="failure",le="0.01"} 1` + "\n",
+		`circuit_breaker_call_duration_seconds_bucket{name="payments",outcome="success",le="0.01"} 1` + "\n",
+		`circuit_breaker_call_duration_seconds_bucket{name="payments",outcome="success",le="+Inf"} 2` + "\n",
+		`circuit_breaker_call_duration_seconds_count{name="payments",outcome="success"} 2` + "\n",
+	} {
+		if !strings.Contains(out, line) {
+			t.Fatal(line, out)
+		}
+	}
+	if strings.Index(out, `outcome="failure"`) > strings.Index(out, `outcome="success"`) {
+		t.Fatal("series are not sorted", out)
+	}
+}
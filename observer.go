@@ -0,0 +1,28 @@
+package main
+
+// Observer 接收熔断器生命周期内的各类事件，所有方法都在触发事件的请求所在的协程中同步调用，可能并发执行
+// 配置WithSerialCallbacks时StateChanged改为按状态切换的顺序在专门的协程中逐个调用
+// 实现时可以嵌入NopObserver，只覆盖需要的方法
+type Observer interface {
+	// StateChanged 状态切换成功后调用，counts是切换前一个周期清空之前的统计数据
+	StateChanged(name string, from, to uint32, reason Reason, counts Counts)
+	// Rejected 请求被拒绝时调用，state为拒绝时的状态，err为返回给调用方的错误
+	Rejected(name string, state uint32, err error)
+	// CallSucceeded 放行的请求成功后调用，state为请求结束时的状态
+	CallSucceeded(name string, state uint32)
+	// CallFailed 放行的请求失败后调用，state为请求结束时的状态
+	CallFailed(name string, state uint32)
+}
+
+// NopObserver 不做任何操作的Observer
+type NopObserver struct{}
+
+func (NopObserver) StateChanged(name string, from, to uint32, reason Reason, counts Counts) {}
+
+func (NopObserver) Rejected(name string, state uint32, err error) {}
+
+func (NopObserver) CallSucceeded(name string, state uint32) {}
+
+func (NopObserver) CallFailed(name string, state uint32) {}
+
+var _ Observer = NopObserver{}
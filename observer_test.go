@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type recordingObserver struct {
+	events []string
+}
+
+func (o *recordingObserver) StateChanged(name string, from, to uint32, reason Reason, counts Counts) {
+	o.events = append(o.events, fmt.Sprintf("%s state %s->%s %s", name, StateString(from), StateString(to), reason))
+}
+
+func (o *recordingObserver) Rejected(name string, state uint32, err error) {
+	o.events = append(o.events, fmt.Sprintf("%s rejected %s %v", name, StateString(state), err))
+}
+
+func (o *recordingObserver) CallSucceeded(name string, state uint32) {
+	o.events = append(o.events, fmt.Sprintf("%s succeeded %s", name, StateString(state)))
+}
+
+func (o *recordingObserver) CallFailed(name string, state uint32) {
+	o.events = append(o.events, fmt.Sprintf("%s failed %s", name, StateString(state)))
+}
+
+// rejectionCounter 只关心被拒绝的请求
+type rejectionCounter struct {
+	NopObserver
+	n int
+}
+
+func (o *rejectionCounter) Rejected(name string, state uint32, err error) {
+	o.n++
+}
+
+func TestCircuitBreakerObserver(t *testing.T) {
+	o := &recordingObserver{}
+	cb := NewCircuitBreaker(60, 2, WithName("payments"), WithObserver(o))
+	_ = success(cb)
+	_ = fail(cb)
+	_ = fail(cb)
+	_ = success(cb)
+	want := []string{
+		"payments succeeded closed",
+		"payments failed closed",
+		"payments failed closed",
+		"payments state closed->open threshold",
+		"payments rejected open circuit breaker is open",
+	}
+	if !reflect.DeepEqual(o.events, want) {
+		t.Fatal(o.events)
+	}
+
+	counter := &rejectionCounter{}
+	cb = NewCircuitBreaker(60, 1, WithObserver(counter))
+	_ = fail(cb)
+	for i := 0; i < 3; i++ {
+		_ = success(cb)
+	}
+	if counter.n != 3 {
+		t.Fatal(counter.n)
+	}
+}
+
+func TestCircuitBreakerRejectSampler(t *testing.T) {
+	sampled := 0
+	cb := NewCircuitBreaker(60, 1, WithRejectSampler(0.1, func() { sampled++ }))
+	DriveToOpen(cb)
+	for i := 0; i < 1000; i++ {
+		_ = success(cb)
+	}
+	if sampled < 95 || sampled > 105 {
+		t.Fatal(sampled)
+	}
+
+	sampled = 0
+	cb = NewCircuitBreaker(60, 1, WithRejectSampler(1, func() { sampled++ }))
+	DriveToOpen(cb)
+	for i := 0; i < 10; i++ {
+		_ = success(cb)
+	}
+	if sampled != 10 {
+		t.Fatal(sampled)
+	}
+}
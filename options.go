@@ -0,0 +1,595 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Option 熔断器的可选配置，在NewCircuitBreaker中按顺序应用
+type Option func(cb *CircuitBreaker)
+
+// WithName 设置熔断器的名称
+func WithName(name string) Option {
+	return func(cb *CircuitBreaker) {
+		cb.name = name
+	}
+}
+
+// WithSoftThreshold 开启关闭状态下的渐进拒绝
+// 连续失败数达到soft后，按curve给出的概率拒绝请求并返回ErrShedding，达到threshold后熔断器开启
+// soft为0或不小于threshold时不生效，curve为nil时使用LinearShedding
+func WithSoftThreshold(soft uint32, curve SheddingCurve) Option {
+	return func(cb *CircuitBreaker) {
+		if soft == 0 || soft >= cb.threshold {
+			return
+		}
+		if curve == nil {
+			curve = LinearShedding
+		}
+		cb.softThreshold = soft
+		cb.sheddingCurve = curve
+	}
+}
+
+// WithAdmissionPolicy 使用自定义的放行策略替换默认策略
+// 配置后WithSoftThreshold不再生效。开启状态下自定义策略放行的请求只计入统计，成功不会让熔断器提前切换到半开启状态
+func WithAdmissionPolicy(policy AdmissionPolicy) Option {
+	return func(cb *CircuitBreaker) {
+		cb.policy = policy
+	}
+}
+
+// WithBucketedWindow 关闭状态下使用滑动窗口统计失败数，窗口由n个时间跨度为interval秒的桶组成
+// 配置后关闭状态下窗口内失败数超过threshold时熔断器开启，而不再要求连续失败
+// 窗口在请求执行前后按当前时间淘汰过期的桶，不会启动后台协程
+func WithBucketedWindow(interval int64, n int) Option {
+	return func(cb *CircuitBreaker) {
+		if interval <= 0 || n <= 0 {
+			return
+		}
+		cb.window = newBucketedWindow(interval, n)
+	}
+}
+
+// WithSharedStatistic 与其他使用同一个SharedStatistic的熔断器共享关闭状态下的失败统计
+// 关闭状态下共享统计中的失败数达到threshold时熔断器开启，即使其中大部分失败是其他熔断器记录的；
+// 失败由其他熔断器记录时，本熔断器在下一次被访问时开启
+// 每个熔断器仍然独立地开启、探测和恢复，任意一个熔断器从半开启状态恢复时清空共享统计
+// 所有共享同一个SharedStatistic的熔断器的关闭状态请求都会竞争它的锁，参考SharedStatistic
+func WithSharedStatistic(s *SharedStatistic) Option {
+	return func(cb *CircuitBreaker) {
+		if s == nil {
+			return
+		}
+		cb.shared = s
+	}
+}
+
+// WithHalfOpenSaturationBackoff 半开启状态下被拒绝的请求占比达到ratio时，认为下游连探测流量都难以承受，
+// 熔断器再次开启时的时间周期变为openInterval * factor
+// 这是一个高级配置，默认不开启，ratio不在(0, 1]之间或factor小于等于1时不生效
+func WithHalfOpenSaturationBackoff(ratio float64, factor int64) Option {
+	return func(cb *CircuitBreaker) {
+		if ratio <= 0 || ratio > 1 || factor <= 1 {
+			return
+		}
+		cb.saturationRatio = ratio
+		cb.saturationFactor = factor
+	}
+}
+
+// WithOnStateChange 设置状态切换的回调，f在触发状态切换的请求所在的协程中同步调用，可能并发执行，参考WithSerialCallbacks
+// counts是切换前一个周期清空之前的统计数据，例如熔断器开启时可以看到导致开启的失败数
+func WithOnStateChange(f func(name string, from, to uint32, reason Reason, counts Counts)) Option {
+	return func(cb *CircuitBreaker) {
+		cb.onStateChange = f
+	}
+}
+
+// WithSerialCallbacks 状态切换相关的回调(WithOnStateChange、Observer.StateChanged、WithSlog、WithFlapping)不再在触发状态切换的协程中同步调用，
+// 而是按状态切换发生的顺序交给一个专门的协程逐个执行，回调之间不会重叠，也不会阻塞请求
+// 回调因此晚于状态切换执行，执行时熔断器可能已经处于其它状态；回调中可以安全地调用Trip、Reset等方法
+func WithSerialCallbacks() Option {
+	return func(cb *CircuitBreaker) {
+		cb.callbacks = &callbackQueue{}
+	}
+}
+
+// WithLateSuccessRecovery 熔断器从半开启状态重新开启后，之前放行的请求迟到的成功结果不再直接丢弃，
+// 每个迟到的成功结果将下一次开启的时间周期缩短step秒，最短为1秒
+// 熔断器切换到关闭状态时清空已经记录的迟到结果，step小于等于0时不生效
+func WithLateSuccessRecovery(step int64) Option {
+	return func(cb *CircuitBreaker) {
+		if step <= 0 {
+			return
+		}
+		cb.lateSuccessStep = step
+	}
+}
+
+// WithFailureRatio 关闭状态下失败率达到ratio并且请求数不少于minRequests时熔断器开启，与threshold同时生效
+// 默认使用当前周期内的全部请求计算失败率，关闭状态持续很久时早期的成功请求会稀释近期的失败，
+// 此时应同时配置WithRequestVolumeWindow
+func WithFailureRatio(ratio float64, minRequests uint32) Option {
+	return func(cb *CircuitBreaker) {
+		if ratio <= 0 || ratio > 1 {
+			return
+		}
+		cb.failureRatio = ratio
+		cb.minRequests = minRequests
+	}
+}
+
+// WithObservationSampling 关闭状态下按失败率开启时只以rate的概率记录请求结果，被抽中的结果按1/rate次计入统计，
+// 失败率仍然代表全部请求，以失败率带有抽样误差为代价减少每个请求对共享统计数据的写入
+// 抽样只在关闭状态下进行，半开启状态和开启状态照常记录全部结果。关闭状态下抽样时只按失败率开启，
+// 连续失败数、WithBucketedWindow等按失败数开启的条件不再生效；Metrics中累计的成功数和失败数不受抽样影响
+// 统计数据是整数，rate必须是1/n(n为不小于2的整数)，例如0.5、0.1、0.01，其它值不生效
+// 只在配置了WithFailureRatio并且使用内置的状态切换规则时生效
+func WithObservationSampling(rate float64) Option {
+	return func(cb *CircuitBreaker) {
+		if weight, ok := samplingWeight(rate); ok {
+			cb.observationWeight = weight
+		}
+	}
+}
+
+// WithRequestVolumeWindow 使用由n个时间跨度为interval秒的桶组成的滑动窗口计算失败率，只统计近期的请求
+// minRequests同样只统计窗口内的请求，因此空闲一段时间后需要重新积累minRequests个请求才会按失败率开启
+func WithRequestVolumeWindow(interval int64, n int) Option {
+	return func(cb *CircuitBreaker) {
+		if interval <= 0 || n <= 0 {
+			return
+		}
+		cb.volume = newBucketedWindow(interval, n)
+	}
+}
+
+// WithRand 设置概率相关功能(例如WithSoftThreshold)使用的随机数源，主要用于在测试中得到确定的结果
+// 熔断器内部会对r加锁，调用方不应再在其它地方使用r
+func WithRand(r *rand.Rand) Option {
+	return func(cb *CircuitBreaker) {
+		if r == nil {
+			return
+		}
+		cb.rand = newLockedRand(r)
+	}
+}
+
+// WithBatchAggregation 设置ExecuteBatch汇总一批请求结果的方式
+func WithBatchAggregation(aggregation BatchAggregation) Option {
+	return func(cb *CircuitBreaker) {
+		cb.batchAggregation = aggregation
+	}
+}
+
+// WithProbeTimeout 半开启状态下从放行第一个探测请求开始超过timeout秒仍有探测请求未返回时，视为探测失败并重新开启熔断器，
+// 避免卡住的探测请求一直占用半开启状态的名额，使熔断器无法恢复。timeout小于等于0时不生效
+func WithProbeTimeout(timeout int64) Option {
+	return func(cb *CircuitBreaker) {
+		if timeout <= 0 {
+			return
+		}
+		cb.probeTimeout = timeout
+	}
+}
+
+// WithHalfOpenLimbo 熔断器停留在半开启状态超过timeout，并且放行的探测请求仍有未返回的，既无法关闭也无法重新开启时调用f，
+// f收到熔断器名称和当前周期的统计数据，每个半开启周期最多调用一次。这种情况通常说明调用方丢弃了探测请求而没有报告结果，
+// f可以记录诊断信息，也可以调用Trip或Reset强制做出决定。f在访问熔断器的协程中同步调用，timeout按秒取整，小于1秒或f为nil时不生效
+func WithHalfOpenLimbo(timeout time.Duration, f func(name string, counts Counts)) Option {
+	return func(cb *CircuitBreaker) {
+		if timeout < time.Second || f == nil {
+			return
+		}
+		cb.limboTimeout = int64(timeout / time.Second)
+		cb.onLimbo = f
+	}
+}
+
+// WithStaleProbeReset 半开启状态下超过timeout没有任何探测请求返回时，归还未返回的探测请求占用的名额，使探测可以继续进行
+// 与WithProbeTimeout不同，它不把未返回的请求视为失败，适用于调用方放弃请求后既不报告成功也不报告失败的场景
+// 同时配置两者时WithProbeTimeout先生效。timeout按秒取整，小于1秒时不生效
+func WithStaleProbeReset(timeout time.Duration) Option {
+	return func(cb *CircuitBreaker) {
+		if timeout < time.Second {
+			return
+		}
+		cb.staleProbeReset = int64(timeout / time.Second)
+	}
+}
+
+// WithHalfOpenSuccessSpread 半开启状态下两次成功至少间隔spread秒才会分别计入关闭熔断器所需的连续成功数，
+// 避免单个客户端在短时间内反复重试成功就让熔断器提前关闭。未计入的成功会归还占用的探测名额
+// spread小于等于0时不生效
+func WithHalfOpenSuccessSpread(spread int64) Option {
+	return func(cb *CircuitBreaker) {
+		if spread <= 0 {
+			return
+		}
+		cb.successSpread = spread
+	}
+}
+
+// WithObserver 设置接收熔断器生命周期事件的Observer，可以与WithOnStateChange同时使用
+func WithObserver(observer Observer) Option {
+	return func(cb *CircuitBreaker) {
+		cb.observer = observer
+	}
+}
+
+// WithHalfOpenQueue 半开启状态下探测名额已满时，请求最多等待maxWait直到有名额释放或熔断器切换状态，
+// 之后重新判断是否放行，仍然无法放行时返回对应的错误。maxWait小于等于0时不生效，直接返回ErrTooManyRequests
+func WithHalfOpenQueue(maxWait time.Duration) Option {
+	return func(cb *CircuitBreaker) {
+		if maxWait <= 0 {
+			return
+		}
+		cb.halfOpenQueue = maxWait
+	}
+}
+
+// WithMaxConcurrency 限制同时执行的请求数，已经有n个请求正在执行时新的请求被拒绝并返回ErrConcurrencyLimit，
+// 与熔断器的状态无关，用于保护本地资源。名额在f返回时归还，ExecuteContext在ctx结束后提前返回、ExecuteHedged的备份请求先成功时，
+// 仍在执行的f继续占用名额直到返回；Reserve放行的请求在调用release时归还
+// RecordSuccess、RecordFailure、ExecuteBypass不经过放行判断，不占用名额。n为0时不限制
+func WithMaxConcurrency(n uint32) Option {
+	return func(cb *CircuitBreaker) {
+		if n > math.MaxInt32 {
+			n = math.MaxInt32
+		}
+		cb.maxConcurrency = int32(n)
+	}
+}
+
+// WithIgnoreIsolatedFailures 关闭状态下忽略孤立的失败：单次失败后紧接着成功时，这次失败不计入失败数、滑动窗口和失败率，
+// 只有连续的失败才会导致熔断器开启，因此开启熔断器至少需要连续失败两次
+func WithIgnoreIsolatedFailures() Option {
+	return func(cb *CircuitBreaker) {
+		cb.ignoreIsolatedFailures = true
+	}
+}
+
+// WithCallFailedError 放行的请求失败(f返回false)时，Execute、ExecuteAt、ExecuteTimed返回err而不是nil，err为nil时使用ErrCallFailed
+// 请求成功或被拒绝时的返回值不变，默认情况下放行的请求无论成功与否都返回nil
+func WithCallFailedError(err error) Option {
+	return func(cb *CircuitBreaker) {
+		if err == nil {
+			err = ErrCallFailed
+		}
+		cb.callFailedError = err
+	}
+}
+
+// WithResetFailuresOnSuccess 设置关闭状态下一次成功是否清零连续失败数，默认为true
+// 配置为false时失败一直累计到周期结束(熔断器切换状态或ResetCounts)，穿插其中的成功不会阻止熔断器开启，周期内失败数达到threshold即开启
+// 配置了WithBucketedWindow时默认为false，窗口内的失败数取代连续失败数；
+// WithFailureRatio按周期或窗口内的全部请求计算失败率，成功本来就不会抹掉失败率中的失败，因此默认仍然为true
+// WithIgnoreIsolatedFailures依赖连续失败的判断，配置后始终清零
+func WithResetFailuresOnSuccess(reset bool) Option {
+	return func(cb *CircuitBreaker) {
+		cb.resetFailuresOnSuccess = reset
+		cb.resetFailuresConfigured = true
+	}
+}
+
+// WithOnProbe 设置放行探测请求的回调，每个半开启周期放行第一个请求时在该请求所在的协程中同步调用f
+// 熔断器切换到半开启状态时不一定有请求到来，f被调用的时刻才是熔断器真正开始恢复放行流量的时刻
+func WithOnProbe(f func()) Option {
+	return func(cb *CircuitBreaker) {
+		cb.onProbe = f
+	}
+}
+
+// WithFailedProbeBackoff 半开启状态下恢复失败后，熔断器再次开启的时间周期按恢复失败的次数逐次乘以factor，
+// 即openInterval * factor^FailedProbes()，最长为maxInterval秒，熔断器关闭后恢复为openInterval
+// factor小于等于1时不生效，maxInterval小于等于0时不限制
+func WithFailedProbeBackoff(factor, maxInterval int64) Option {
+	return func(cb *CircuitBreaker) {
+		if factor <= 1 {
+			return
+		}
+		cb.probeBackoffFactor = factor
+		cb.probeBackoffMax = maxInterval
+	}
+}
+
+// WithMaxOpenDuration 开启状态持续超过d后强制切换到半开启状态，不受openInterval以及各种延长开启时间周期的配置影响，
+// 作为安全阀避免熔断器因为配置错误一直拒绝请求。d按秒取整，小于1秒时不生效
+func WithMaxOpenDuration(d time.Duration) Option {
+	return func(cb *CircuitBreaker) {
+		if d < time.Second {
+			return
+		}
+		cb.maxOpenDuration = int64(d / time.Second)
+	}
+}
+
+// WithMaxHalfOpenDuration 半开启状态持续超过d仍没有关闭或重新开启时强制切换到开启状态，closeOnTimeout为true时切换到关闭状态
+// 流量稀少时半开启状态可能既积累不到足够的成功也等不到一次失败，一直停留在半开启状态，配置后总会在d之后做出决定
+// 切换的原因为ReasonMaxHalfOpenDuration，切换到开启状态时与探测失败一样参与WithFailedProbeBackoff的退避
+// 半开启状态的持续时间按熔断器的时钟计算，参考WithClock；与其它状态切换一样只在访问熔断器时发生。d按秒取整，小于1秒时不生效
+func WithMaxHalfOpenDuration(d time.Duration, closeOnTimeout bool) Option {
+	return func(cb *CircuitBreaker) {
+		if d < time.Second {
+			return
+		}
+		cb.maxHalfOpenDuration = int64(d / time.Second)
+		cb.maxHalfOpenClose = closeOnTimeout
+	}
+}
+
+// WithStartupGracePeriod 创建熔断器之后的d内，关闭状态下的失败和慢调用照常计入统计，但不会开启熔断器，
+// 用于进程刚启动时建立连接等预期之内的短暂失败。宽限期结束后恢复正常，宽限期内已经累计的失败在下一次失败时一并参与判断
+// 宽限期按熔断器的时钟计算(参考WithClock)，不影响Trip以及自定义TransitionStrategy。d按秒取整，小于1秒时不生效
+func WithStartupGracePeriod(d time.Duration) Option {
+	return func(cb *CircuitBreaker) {
+		if d < time.Second {
+			return
+		}
+		cb.startupGrace = int64(d / time.Second)
+	}
+}
+
+// WithCooldownAfterClose 熔断器每次切换到关闭状态时获得credit个额度，关闭状态下的每次失败先消耗一个额度，
+// 被抵消的失败只计入失败数，不计入连续失败数和滑动窗口，因此刚刚恢复后的几次失败不会立即累积到阈值；
+// 每次成功同样消耗一个额度，随着正常流量证明下游已经稳定，额度逐渐归零，之后恢复正常的开启判断
+// 与WithMinimumClosedDuration按时间放宽不同，额度按流量消耗。credit为0时不生效
+func WithCooldownAfterClose(credit uint32) Option {
+	return func(cb *CircuitBreaker) {
+		cb.cooldownCredit = credit
+	}
+}
+
+// WithMinimumClosedDuration 熔断器从半开启状态恢复到关闭状态之后的d内，开启熔断器所需的失败数(连续失败数或滑动窗口内的失败数)增加forgiveness，
+// 给刚刚恢复的下游留出稳定的时间，避免恢复之后的一次失败立即重新开启导致状态反复切换。按失败率开启的判断不受影响
+// d按秒取整，小于1秒或forgiveness为0时不生效
+func WithMinimumClosedDuration(d time.Duration, forgiveness uint32) Option {
+	return func(cb *CircuitBreaker) {
+		if d < time.Second || forgiveness == 0 {
+			return
+		}
+		cb.minClosedDuration = int64(d / time.Second)
+		cb.closedForgiveness = forgiveness
+	}
+}
+
+// WithRecoveryConfirmWindow 半开启状态下满足恢复的条件(连续成功数或成功率)之后不立即关闭熔断器，而是再经过d的确认窗口：
+// 窗口内满足条件的成功归还占用的探测名额，探测请求继续按原有的名额放行，任何使熔断器重新开启的失败都会照常生效；
+// 窗口结束时仍处于半开启状态才关闭熔断器。适用于恢复过程不稳定、第一次成功之后可能很快又失败的下游
+// 只影响从半开启状态到关闭状态的切换，d按秒取整，小于1秒时不生效
+func WithRecoveryConfirmWindow(d time.Duration) Option {
+	return func(cb *CircuitBreaker) {
+		if d < time.Second {
+			return
+		}
+		cb.confirmWindow = int64(d / time.Second)
+	}
+}
+
+// WithHalfOpenSuccessRatio 半开启状态下不再按连续成功数判断是否恢复，而是积累至少minRequests个请求后按成功率判断：
+// 成功率达到ratio时关闭熔断器，否则重新开启，适用于半开启状态下仍有大量真实流量、少量失败不代表没有恢复的场景
+// 与WithFailureRatio使用相同的数据来源，配置了WithRequestVolumeWindow时只统计窗口内的请求
+// 默认放行策略在半开启状态下最多放行threshold和minRequests中较大的请求数。ratio不在(0, 1]之间时不生效
+func WithHalfOpenSuccessRatio(ratio float64, minRequests uint32) Option {
+	return func(cb *CircuitBreaker) {
+		if ratio <= 0 || ratio > 1 {
+			return
+		}
+		cb.halfOpenSuccessRatio = ratio
+		cb.halfOpenMinRequests = minRequests
+	}
+}
+
+// WithTap 设置请求结果计入统计之前调用的函数，f的返回值代替原来的结果计入统计、累计数据和Observer，
+// 例如外部已经确认是短暂故障时把失败改为成功。f不影响Execute等方法的返回值
+// f在每个请求结束时同步调用，应当尽快返回并且避免副作用
+func WithTap(f func(success bool) bool) Option {
+	return func(cb *CircuitBreaker) {
+		cb.tap = f
+	}
+}
+
+// WithCountFailure 设置请求失败时调用的判断函数，f返回false时这次失败完全不计入统计、累计数据和Observer，并归还占用的名额，
+// 用于排除参数错误等在调用方本地就快速失败、与下游健康无关的请求。只在请求失败时(包括WithTap转换之后)调用，
+// 在失败的请求所在的协程中同步调用，通常从协程绑定的上下文中读取这次请求的信息。未配置时所有失败都计入
+func WithCountFailure(f func() bool) Option {
+	return func(cb *CircuitBreaker) {
+		cb.countFailure = f
+	}
+}
+
+// WithThreadLocalProbe 半开启状态下按分片判断是否恢复，适用于分片的下游中一个分片恢复不代表全部恢复的场景
+// 每个成功的探测请求结束时在其所在的协程中调用shard获取分片标识(例如从协程绑定的上下文中读取)，
+// 除了原有的条件外，还需要至少required个不同的分片成功才会关闭熔断器；成功只来自少数分片时归还占用的探测名额，继续放行其它请求
+// shard在记录结果的协程中调用，只有Execute这类在调用方协程中执行f的方法能读到f所在协程的分片：
+// ExecuteContext、ExecuteContextErr、ExecuteHedged在新的协程中执行f，却在调用方协程中记录结果，ExecuteAsync的放行和记录都在新的协程中，
+// 这些方法不支持依赖协程绑定信息的shard。shard为nil或required小于等于1时不生效
+func WithThreadLocalProbe(shard func() string, required int) Option {
+	return func(cb *CircuitBreaker) {
+		if shard == nil || required <= 1 {
+			return
+		}
+		cb.shards = newProbeShards(shard, required)
+	}
+}
+
+// WithHalfOpenSuccessDecay 半开启状态下两次成功间隔超过decay时，之前积累的连续成功失效并归还占用的探测名额，
+// 避免熔断器根据间隔很久、早已过时的成功关闭。decay按秒取整，小于1秒时不生效
+func WithHalfOpenSuccessDecay(decay time.Duration) Option {
+	return func(cb *CircuitBreaker) {
+		if decay < time.Second {
+			return
+		}
+		cb.successDecay = int64(decay / time.Second)
+	}
+}
+
+// WithClock 设置熔断器自己的时间源，优先于包级别的Now，适用于无法替换全局时间源的测试
+// now返回的时间应单调不减，使用time.Now时与默认行为相同
+func WithClock(now func() time.Time) Option {
+	return func(cb *CircuitBreaker) {
+		if now == nil {
+			return
+		}
+		cb.epoch = now()
+		cb.since = func(t time.Time) time.Duration {
+			return now().Sub(t)
+		}
+	}
+}
+
+// WithTripOnConsecutiveSlowCalls 关闭状态下连续count个请求的执行耗时都达到slow时熔断器开启，与请求是否成功无关，
+// 用于下游不返回错误但整体变慢的场景。慢调用的计数与失败数相互独立，一次耗时小于slow的请求会清零连续慢调用数
+// 只统计通过Execute、ExecuteAt、ExecuteResult、ExecuteTimed、ExecuteContext、Call执行的请求，slow小于等于0或count为0时不生效
+func WithTripOnConsecutiveSlowCalls(slow time.Duration, count uint32) Option {
+	return func(cb *CircuitBreaker) {
+		if slow <= 0 || count == 0 {
+			return
+		}
+		cb.slowCallDuration = slow
+		cb.slowCallCount = count
+	}
+}
+
+// WithPercentileSlowCalls 关闭状态下按最近请求耗时的percentile分位乘以multiplier作为慢调用的阈值，
+// 连续count个请求的执行耗时都达到阈值时熔断器开启，例如percentile为0.5、multiplier为3时，耗时超过最近p50的3倍视为慢调用
+// 阈值随下游耗时的基线变化，基线缓慢升高时阈值随之升高，突然变慢时在阈值跟上之前开启熔断器
+// 只使用关闭状态下最近128个请求的耗时，少于32个样本时不检测慢调用，可以通过SlowCallThreshold查看当前的阈值
+// 配置后取代WithTripOnConsecutiveSlowCalls的固定阈值，其余规则与其相同
+// percentile不在(0, 1]之间、multiplier小于等于0或count为0时不生效
+func WithPercentileSlowCalls(percentile, multiplier float64, count uint32) Option {
+	return func(cb *CircuitBreaker) {
+		if percentile <= 0 || percentile > 1 || multiplier <= 0 || count == 0 {
+			return
+		}
+		cb.latency = newLatencySampler(percentile, multiplier)
+		cb.slowCallCount = count
+	}
+}
+
+// WithLatencyObserver 设置接收请求执行耗时的回调，每个放行并执行完成的请求结束时以熔断器名称、请求是否成功和执行耗时调用f，
+// 复用慢调用检测测量的耗时，不会重复读取时钟。可以直接使用LatencyHistogram按名称和结果统计耗时分布并以Prometheus格式导出，例如
+//
+//	latency := NewLatencyHistogram("circuit_breaker_call_duration_seconds")
+//	cb := NewCircuitBreaker(60, 5, WithName("payments"), WithLatencyObserver(latency.Observe))
+//
+// 也可以在f中记录到Prometheus客户端库的直方图等其它监控系统
+// 只统计通过Execute、ExecuteAt、ExecuteResult、ExecuteTimed、ExecuteContext、ExecuteWithDeadline、Call执行的请求，
+// 结果被WithErrorPredicate忽略的请求不会回调。f在请求所在的协程中同步调用，应当尽快返回
+func WithLatencyObserver(f func(name string, success bool, elapsed time.Duration)) Option {
+	return func(cb *CircuitBreaker) {
+		cb.onLatency = f
+	}
+}
+
+// WithFlapping 最近10分钟内平均每分钟的状态切换次数(参考FlapRate)超过threshold时调用f，
+// 只在切换频率从不超过threshold变为超过时调用一次，f在触发状态切换的请求所在的协程中同步调用
+func WithFlapping(threshold float64, f func(name string, rate float64)) Option {
+	return func(cb *CircuitBreaker) {
+		if threshold <= 0 || f == nil {
+			return
+		}
+		cb.flapThreshold = threshold
+		cb.onFlapping = f
+	}
+}
+
+// WithOpenSampling 开启状态下不再拒绝所有请求，而是按fraction的概率放行少量请求持续探测下游是否恢复
+// 这些请求的结果同样计入统计，连续成功达到threshold时熔断器提前切换到半开启状态，不必等待openInterval结束
+// 只对默认放行策略生效，配置WithAdmissionPolicy后不再生效。fraction不在(0, 1]之间时不生效
+func WithOpenSampling(fraction float64) Option {
+	return func(cb *CircuitBreaker) {
+		if fraction <= 0 || fraction > 1 {
+			return
+		}
+		cb.openSampling = fraction
+	}
+}
+
+// WithOutcomeFunc 设置判断Do执行的请求计入统计方式的函数，f同时收到请求的结果和错误，返回OutcomeSuccess、OutcomeFailure或OutcomeIgnore，
+// 可以在一处表达所有的判断逻辑，例如把某些错误视为成功、把不符合预期的结果视为失败、忽略调用方取消的请求
+// 未配置时err为nil计为成功，否则计为失败。对Do、ExecuteContextErr、ExecuteWithCache和ExecuteResult生效，返回其它值时计为失败；
+// ExecuteResult未配置时仍按f返回的bool判断
+func WithOutcomeFunc(f func(result interface{}, err error) Outcome) Option {
+	return func(cb *CircuitBreaker) {
+		cb.outcome = f
+	}
+}
+
+// WithRecentErrors 设置RecentErrors保存的最近失败的错误数，默认只保存最近一次，size小于等于0时不生效
+func WithRecentErrors(size int) Option {
+	return func(cb *CircuitBreaker) {
+		if size <= 0 {
+			return
+		}
+		cb.recent = newRecentErrors(size)
+	}
+}
+
+// WithErrorPredicate 用于通过其它途径报告错误的框架：f返回false后，在执行f的协程中立即调用capture获取f最近一次的错误，
+// isFailure返回false时这次请求不计为失败也不计为成功，归还占用的名额，Execute等方法返回nil
+// capture返回nil时按f的返回值计为失败。capture在f返回之后、结果计入统计之前调用，f返回true时不会调用
+// 只对Execute、ExecuteAt、ExecuteTimed、ExecuteContext、Call生效，capture或isFailure为nil时不生效
+func WithErrorPredicate(capture func() error, isFailure func(err error) bool) Option {
+	return func(cb *CircuitBreaker) {
+		if capture == nil || isFailure == nil {
+			return
+		}
+		cb.captureError = capture
+		cb.isFailure = isFailure
+	}
+}
+
+// WithTransitionStrategy 使用自定义的状态切换规则替换内置规则，例如增加新的状态或者跳过半开启状态
+// 配置后统计数据、回调、放行策略、慢调用检测照常工作，开启周期由strategy的Refresh决定，openInterval不再生效，
+// 以下内置的切换条件也不再生效，同时配置时被忽略(Config.Validate会报告这些组合)：
+// WithBucketedWindow、WithSharedStatistic、WithFailureRatio、WithRequestVolumeWindow、WithObservationSampling、
+// WithHalfOpenSaturationBackoff、WithLateSuccessRecovery、WithFailedProbeBackoff、WithMaxOpenDuration、
+// WithHalfOpenSuccessRatio、WithRecoveryConfirmWindow、WithProbeTimeout、WithStaleProbeReset、WithHalfOpenSuccessSpread、
+// WithHalfOpenSuccessDecay、WithMaxHalfOpenDuration、WithBaselineHealthCheck、WithThreadLocalProbe、WithCooldownAfterClose、
+// WithStartupGracePeriod、WithMinimumClosedDuration、WithIgnoreIsolatedFailures
+func WithTransitionStrategy(strategy TransitionStrategy) Option {
+	return func(cb *CircuitBreaker) {
+		cb.strategy = strategy
+	}
+}
+
+// WithRampUp 半开启状态下不再只放行threshold个探测请求，而是按比例放行流量，并随着连续成功逐步提高比例，
+// 连续成功数为i时放行概率为schedule[i]，超出schedule的部分使用最后一个值，例如0.1、0.5、1表示依次放行10%、50%、全部流量，
+// 连续成功达到threshold时熔断器关闭，任意一次失败重新开启。只对默认放行策略生效，schedule中有不在(0, 1]之间的值时不生效
+func WithRampUp(schedule ...float64) Option {
+	return func(cb *CircuitBreaker) {
+		if len(schedule) == 0 {
+			return
+		}
+		for _, fraction := range schedule {
+			if fraction <= 0 || fraction > 1 {
+				return
+			}
+		}
+		cb.rampUp = append([]float64(nil), schedule...)
+	}
+}
+
+// WithBaselineHealthCheck 设置半开启状态下关闭熔断器之前必须通过的健康检查，例如建立TCP连接或ping
+// 每个半开启周期第一个成功的探测请求结束时在其所在的协程中同步调用check，通过之后才开始按成功计入恢复的判断；
+// 检查失败时熔断器以ReasonHealthCheck重新开启，即使探测请求本身成功。只对内置的状态切换规则生效
+func WithBaselineHealthCheck(check func() bool) Option {
+	return func(cb *CircuitBreaker) {
+		cb.healthCheck = check
+	}
+}
+
+// WithRejectSampler 请求被拒绝时按rate的比例抽样调用fn，用于在高并发下只对一部分被拒绝的请求记录调用栈或请求上下文
+// fn在被拒绝的请求所在的协程中同步调用，抽样本身只使用一次原子操作，不加锁也不依赖随机数。rate不在(0, 1]之间或fn为nil时不生效
+func WithRejectSampler(rate float64, fn func()) Option {
+	return func(cb *CircuitBreaker) {
+		if rate <= 0 || rate > 1 || fn == nil {
+			return
+		}
+		cb.rejectSampleRate = rate
+		cb.onRejectSample = fn
+	}
+}
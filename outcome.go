@@ -0,0 +1,66 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Outcome Do执行的请求计入熔断器统计的方式
+type Outcome uint32
+
+const (
+	OutcomeSuccess Outcome = 1 // 计为成功
+	OutcomeFailure Outcome = 2 // 计为失败
+	OutcomeIgnore  Outcome = 3 // 不计入统计，归还占用的名额，与没有执行过一样
+)
+
+// classify 按WithOutcomeFunc配置的函数判断请求的结果，未配置时err为nil计为成功，否则计为失败
+func (cb *CircuitBreaker) classify(result interface{}, err error) Outcome {
+	if cb.outcome != nil {
+		return cb.outcome(result, err)
+	}
+	if err != nil {
+		return OutcomeFailure
+	}
+	return OutcomeSuccess
+}
+
+// classifiers 通过RegisterClassifier注册、可以在ParseConfig中按名称引用的结果判断函数
+var (
+	classifiersMu sync.RWMutex
+	classifiers   = map[string]func(result interface{}, err error) Outcome{}
+)
+
+// RegisterClassifier 将结果判断函数f注册为name，之后ParseConfig可以通过"classifier": name引用它，效果与WithOutcomeFunc(f)相同
+// 重复注册同一个名称时替换之前的函数，只影响之后解析的配置。name为空或f为nil时忽略
+// 该注册是进程级别的，建议在init中调用
+func RegisterClassifier(name string, f func(result interface{}, err error) Outcome) {
+	if name == "" || f == nil {
+		return
+	}
+	classifiersMu.Lock()
+	classifiers[name] = f
+	classifiersMu.Unlock()
+}
+
+func lookupClassifier(name string) (func(result interface{}, err error) Outcome, bool) {
+	classifiersMu.RLock()
+	defer classifiersMu.RUnlock()
+	f, ok := classifiers[name]
+	return f, ok
+}
+
+// classifierName 返回f通过RegisterClassifier注册的名称，未配置时为空字符串，没有注册时为"custom"
+func classifierName(f func(result interface{}, err error) Outcome) string {
+	if f == nil {
+		return ""
+	}
+	classifiersMu.RLock()
+	defer classifiersMu.RUnlock()
+	for name, c := range classifiers {
+		if reflect.ValueOf(c).Pointer() == reflect.ValueOf(f).Pointer() {
+			return name
+		}
+	}
+	return "custom"
+}
@@ -0,0 +1,102 @@
+package main
+
+// Counts 熔断器当前周期的统计数据
+type Counts struct {
+	Requests            uint32 // 熔断器通过的请求数
+	ContinuousSuccesses uint32 // 连续成功的请求数，最多累加到threshold
+	ContinuousFailures  uint32 // 连续失败的请求数，最多累加到threshold
+	Successes           uint32 // 成功的请求数
+	Failures            uint32 // 失败的请求数
+	ContinuousSlowCalls uint32 // 关闭状态下连续的慢调用数，参考WithTripOnConsecutiveSlowCalls
+}
+
+// AdmissionPolicy 决定熔断器在各个状态下是否放行请求
+// 返回false时请求被拒绝，关闭、半开启、开启状态分别返回ErrShedding、ErrTooManyRequests、ErrOpenState
+type AdmissionPolicy interface {
+	AdmitClosed(counts Counts) bool
+	AdmitHalfOpen(counts Counts) bool
+	AdmitOpen(counts Counts) bool
+}
+
+// SheddingCurve 根据当前连续失败数计算关闭状态下拒绝请求的概率，返回值应在[0, 1]之间
+// soft <= failures < hard
+type SheddingCurve func(failures, soft, hard uint32) float64
+
+// LinearShedding 拒绝概率随连续失败数从soft到hard线性增长
+func LinearShedding(failures, soft, hard uint32) float64 {
+	return float64(failures-soft+1) / float64(hard-soft+1)
+}
+
+// defaultAdmissionPolicy 默认的放行策略
+// 关闭状态下放行所有请求(配置了softThreshold时按概率拒绝)，半开启状态下最多放行threshold个请求，
+// 开启状态下拒绝所有请求(配置了openSampling时按概率放行)
+type defaultAdmissionPolicy struct {
+	rand          *lockedRand
+	threshold     uint32
+	softThreshold uint32
+	sheddingCurve SheddingCurve
+	// halfOpenRequests 大于threshold时半开启状态下最多放行的请求数，用于按成功率判断恢复时积累足够的样本
+	halfOpenRequests uint32
+	// openSampling 开启状态下按此概率放行请求，0表示拒绝所有请求
+	openSampling float64
+	// rampUp 半开启状态下按连续成功数逐步提高的放行概率，配置后不再限制半开启状态下的请求数
+	rampUp []float64
+}
+
+func (p *defaultAdmissionPolicy) AdmitClosed(counts Counts) bool {
+	if p.softThreshold == 0 || counts.ContinuousFailures < p.softThreshold {
+		return true
+	}
+	return p.rand.Float64() >= p.sheddingCurve(counts.ContinuousFailures, p.softThreshold, p.threshold)
+}
+
+func (p *defaultAdmissionPolicy) AdmitHalfOpen(counts Counts) bool {
+	if len(p.rampUp) > 0 {
+		step := int(counts.ContinuousSuccesses)
+		if step >= len(p.rampUp) {
+			step = len(p.rampUp) - 1
+		}
+		return p.rand.Float64() < p.rampUp[step]
+	}
+	limit := p.threshold
+	if p.halfOpenRequests > limit {
+		limit = p.halfOpenRequests
+	}
+	return counts.Requests < limit
+}
+
+func (p *defaultAdmissionPolicy) AdmitOpen(counts Counts) bool {
+	if p.openSampling <= 0 {
+		return false
+	}
+	return p.rand.Float64() < p.openSampling
+}
+
+// admitChance 返回state状态下请求被放行的概率，与Admit*的判断一致，但不消耗随机数，供Allowable使用
+func (p *defaultAdmissionPolicy) admitChance(state uint32, counts Counts) float64 {
+	switch state {
+	case StateOpen:
+		return p.openSampling
+	case StateHalfOpen:
+		if len(p.rampUp) > 0 {
+			step := int(counts.ContinuousSuccesses)
+			if step >= len(p.rampUp) {
+				step = len(p.rampUp) - 1
+			}
+			return p.rampUp[step]
+		}
+		limit := p.threshold
+		if p.halfOpenRequests > limit {
+			limit = p.halfOpenRequests
+		}
+		if counts.Requests < limit {
+			return 1
+		}
+		return 0
+	default:
+		if p.softThreshold == 0 || counts.ContinuousFailures < p.softThreshold {
+			return 1
+		}
+		return 1 - p.sheddingCurve(counts.ContinuousFailures, p.softThreshold, p.threshold)
+	}
+}
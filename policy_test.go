@@ -0,0 +1,106 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// sampledPolicy 开启状态下每sample个请求放行一个，半开启状态下拒绝所有请求
+type sampledPolicy struct {
+	sample uint32
+	n      uint32
+}
+
+func (p *sampledPolicy) AdmitClosed(counts Counts) bool {
+	return true
+}
+
+func (p *sampledPolicy) AdmitHalfOpen(counts Counts) bool {
+	return false
+}
+
+func (p *sampledPolicy) AdmitOpen(counts Counts) bool {
+	p.n++
+	return p.n%p.sample == 0
+}
+
+func TestCircuitBreakerAdmissionPolicy(t *testing.T) {
+	cb := NewCircuitBreaker(60, 3, WithAdmissionPolicy(&sampledPolicy{sample: 4}))
+	for i := 0; i < 3; i++ {
+		if err := fail(cb); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// open，自定义放行策略放行的请求成功不会让熔断器提前切换到半开启状态
+	admitted := 0
+	for i := 0; i < 20; i++ {
+		err := success(cb)
+		if err == nil {
+			admitted++
+		} else if err != ErrOpenState {
+			t.Fatal(err)
+		}
+	}
+	if admitted != 5 {
+		t.Fatal(admitted)
+	}
+	RequireState(t, cb, StateOpen)
+	// half open
+	DriveToHalfOpen(cb)
+	if err := success(cb); err != ErrTooManyRequests {
+		t.Fatal(err)
+	}
+}
+
+func TestCircuitBreakerOpenSampling(t *testing.T) {
+	cb := NewCircuitBreaker(60, 3, WithOpenSampling(0.1), WithRand(rand.New(rand.NewSource(1))))
+	DriveToOpen(cb)
+	admitted := 0
+	for i := 0; i < 10000; i++ {
+		if err := fail(cb); err == nil {
+			admitted++
+		}
+	}
+	// 失败的请求不会让熔断器离开开启状态
+	RequireState(t, cb, StateOpen)
+	if admitted < 900 || admitted > 1100 {
+		t.Fatal(admitted)
+	}
+	// 放行的请求连续成功达到threshold后提前切换到半开启状态
+	for i := 0; i < 1000 && cb.State() == StateOpen; i++ {
+		_ = success(cb)
+	}
+	RequireState(t, cb, StateHalfOpen)
+
+	// 默认不放行
+	cb = NewCircuitBreaker(60, 3)
+	DriveToOpen(cb)
+	for i := 0; i < 1000; i++ {
+		if err := success(cb); err != ErrOpenState {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCircuitBreakerRampUp(t *testing.T) {
+	cb := NewCircuitBreaker(60, 4, WithRampUp(0.1, 0.5, 1), WithRand(rand.New(rand.NewSource(1))))
+	DriveToHalfOpen(cb)
+	fraction := func() float64 {
+		admitted := 0
+		for i := 0; i < 10000; i++ {
+			if cb.policy.AdmitHalfOpen(cb.Counts()) {
+				admitted++
+			}
+		}
+		return float64(admitted) / 10000
+	}
+	for i, want := range []float64{0.1, 0.5, 1, 1} {
+		if got := fraction(); got < want-0.03 || got > want+0.03 {
+			t.Fatal(i, got, want)
+		}
+		// 连续成功后放行比例提高
+		for cb.Execute(func() bool { return true }) != nil {
+		}
+	}
+	RequireState(t, cb, StateClosed)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// profile 熔断器配置的JSON表示，时间使用"30s"、"1m"这样的字符串，曲线和汇总方式使用名称
+type profile struct {
+	OpenInterval             string         `json:"openInterval"`
+	Threshold                uint32         `json:"threshold"`
+	SoftThreshold            uint32         `json:"softThreshold"`
+	SheddingCurve            string         `json:"sheddingCurve"`
+	Window                   *profileWindow `json:"window"`
+	SaturationRatio          float64        `json:"saturationRatio"`
+	SaturationFactor         int64          `json:"saturationFactor"`
+	LateSuccessStep          string         `json:"lateSuccessStep"`
+	FailureRatio             float64        `json:"failureRatio"`
+	MinRequests              uint32         `json:"minRequests"`
+	ObservationSampling      float64        `json:"observationSampling"`
+	VolumeWindow             *profileWindow `json:"volumeWindow"`
+	HalfOpenSuccessRatio     float64        `json:"halfOpenSuccessRatio"`
+	HalfOpenMinRequests      uint32         `json:"halfOpenMinRequests"`
+	RecoveryConfirmWindow    string         `json:"recoveryConfirmWindow"`
+	OpenSampling             float64        `json:"openSampling"`
+	RampUp                   []float64      `json:"rampUp"`
+	ProbeTimeout             string         `json:"probeTimeout"`
+	StaleProbeReset          string         `json:"staleProbeReset"`
+	HalfOpenSuccessSpread    string         `json:"halfOpenSuccessSpread"`
+	HalfOpenSuccessDecay     string         `json:"halfOpenSuccessDecay"`
+	HalfOpenQueue            string         `json:"halfOpenQueue"`
+	MaxConcurrency           uint32         `json:"maxConcurrency"`
+	FailedProbeBackoffFactor int64          `json:"failedProbeBackoffFactor"`
+	FailedProbeBackoffMax    string         `json:"failedProbeBackoffMax"`
+	MaxOpenDuration          string         `json:"maxOpenDuration"`
+	MaxHalfOpenDuration      string         `json:"maxHalfOpenDuration"`
+	MaxHalfOpenClose         bool           `json:"maxHalfOpenClose"`
+	CooldownAfterClose       uint32         `json:"cooldownAfterClose"`
+	StartupGracePeriod       string         `json:"startupGracePeriod"`
+	MinimumClosedDuration    string         `json:"minimumClosedDuration"`
+	MinimumClosedForgiveness uint32         `json:"minimumClosedForgiveness"`
+	SlowCallDuration         string         `json:"slowCallDuration"`
+	SlowCallCount            uint32         `json:"slowCallCount"`
+	SlowCallPercentile       float64        `json:"slowCallPercentile"`
+	SlowCallMultiplier       float64        `json:"slowCallMultiplier"`
+	RecentErrors             int            `json:"recentErrors"`
+	IgnoreIsolatedFailures   bool           `json:"ignoreIsolatedFailures"`
+	ResetFailuresOnSuccess   *bool          `json:"resetFailuresOnSuccess"`
+	BatchAggregation         string         `json:"batchAggregation"`
+	Classifier               string         `json:"classifier"`
+}
+
+// profileWindow 滑动窗口的JSON表示
+type profileWindow struct {
+	Interval string `json:"interval"`
+	Buckets  int    `json:"buckets"`
+}
+
+// sheddingCurves 可以在JSON中按名称引用的拒绝概率曲线
+var sheddingCurves = map[string]SheddingCurve{
+	"linear": LinearShedding,
+}
+
+// batchAggregations 可以在JSON中按名称引用的批量结果汇总方式
+var batchAggregations = map[string]BatchAggregation{
+	"all": BatchAllSuccess,
+	"any": BatchAnySuccess,
+}
+
+// ParseConfig 将JSON格式的熔断器配置解析为Config，解析结果可以直接用于NewFromConfig
+// 时间字段使用time.ParseDuration支持的字符串，以秒为单位的字段必须是整数秒；sheddingCurve支持"linear"，batchAggregation支持"all"和"any"，
+// classifier引用通过RegisterClassifier注册的结果判断函数；
+// 滑动窗口写作{"interval": "10s", "buckets": 6}。省略的字段使用默认值，未知字段、格式错误以及Validate不通过时返回错误，
+// 格式错误的信息中包含字段路径，例如window.interval
+func ParseConfig(data []byte) (Config, error) {
+	var p profile
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return Config{}, fmt.Errorf("invalid config: %v", err)
+	}
+	var errs []string
+	seconds := func(path, s string) int64 {
+		d := duration(path, s, &errs)
+		if d%time.Second != 0 {
+			errs = append(errs, fmt.Sprintf("%s: %q is not a whole number of seconds", path, s))
+		}
+		return int64(d / time.Second)
+	}
+	c := Config{
+		OpenInterval:             seconds("openInterval", p.OpenInterval),
+		Threshold:                p.Threshold,
+		SoftThreshold:            p.SoftThreshold,
+		SaturationRatio:          p.SaturationRatio,
+		SaturationFactor:         p.SaturationFactor,
+		LateSuccessStep:          seconds("lateSuccessStep", p.LateSuccessStep),
+		FailureRatio:             p.FailureRatio,
+		MinRequests:              p.MinRequests,
+		ObservationSampling:      p.ObservationSampling,
+		HalfOpenSuccessRatio:     p.HalfOpenSuccessRatio,
+		HalfOpenMinRequests:      p.HalfOpenMinRequests,
+		RecoveryConfirmWindow:    duration("recoveryConfirmWindow", p.RecoveryConfirmWindow, &errs),
+		OpenSampling:             p.OpenSampling,
+		RampUp:                   p.RampUp,
+		ProbeTimeout:             seconds("probeTimeout", p.ProbeTimeout),
+		StaleProbeReset:          duration("staleProbeReset", p.StaleProbeReset, &errs),
+		HalfOpenSuccessSpread:    seconds("halfOpenSuccessSpread", p.HalfOpenSuccessSpread),
+		HalfOpenSuccessDecay:     duration("halfOpenSuccessDecay", p.HalfOpenSuccessDecay, &errs),
+		HalfOpenQueue:            duration("halfOpenQueue", p.HalfOpenQueue, &errs),
+		MaxConcurrency:           p.MaxConcurrency,
+		FailedProbeBackoffFactor: p.FailedProbeBackoffFactor,
+		FailedProbeBackoffMax:    seconds("failedProbeBackoffMax", p.FailedProbeBackoffMax),
+		MaxOpenDuration:          duration("maxOpenDuration", p.MaxOpenDuration, &errs),
+		MaxHalfOpenDuration:      duration("maxHalfOpenDuration", p.MaxHalfOpenDuration, &errs),
+		MaxHalfOpenClose:         p.MaxHalfOpenClose,
+		CooldownAfterClose:       p.CooldownAfterClose,
+		StartupGracePeriod:       duration("startupGracePeriod", p.StartupGracePeriod, &errs),
+		MinimumClosedDuration:    duration("minimumClosedDuration", p.MinimumClosedDuration, &errs),
+		MinimumClosedForgiveness: p.MinimumClosedForgiveness,
+		SlowCallDuration:         duration("slowCallDuration", p.SlowCallDuration, &errs),
+		SlowCallCount:            p.SlowCallCount,
+		SlowCallPercentile:       p.SlowCallPercentile,
+		SlowCallMultiplier:       p.SlowCallMultiplier,
+		RecentErrors:             p.RecentErrors,
+		IgnoreIsolatedFailures:   p.IgnoreIsolatedFailures,
+		ResetFailuresOnSuccess:   p.ResetFailuresOnSuccess,
+	}
+	if p.Window != nil {
+		c.WindowInterval = seconds("window.interval", p.Window.Interval)
+		c.WindowBuckets = p.Window.Buckets
+	}
+	if p.VolumeWindow != nil {
+		c.VolumeWindowInterval = seconds("volumeWindow.interval", p.VolumeWindow.Interval)
+		c.VolumeWindowBuckets = p.VolumeWindow.Buckets
+	}
+	if p.SheddingCurve != "" {
+		if curve, ok := sheddingCurves[p.SheddingCurve]; ok {
+			c.SheddingCurve = curve
+		} else {
+			errs = append(errs, fmt.Sprintf("sheddingCurve: unknown curve %q", p.SheddingCurve))
+		}
+	}
+	if p.BatchAggregation != "" {
+		if aggregation, ok := batchAggregations[p.BatchAggregation]; ok {
+			c.BatchAggregation = aggregation
+		} else {
+			errs = append(errs, fmt.Sprintf("batchAggregation: unknown aggregation %q", p.BatchAggregation))
+		}
+	}
+	if p.Classifier != "" {
+		if classifier, ok := lookupClassifier(p.Classifier); ok {
+			c.OutcomeFunc = classifier
+		} else {
+			errs = append(errs, fmt.Sprintf("classifier: unknown classifier %q", p.Classifier))
+		}
+	}
+	if len(errs) != 0 {
+		return Config{}, fmt.Errorf("invalid config: %s", strings.Join(errs, "; "))
+	}
+	if err := c.Validate(); err != nil {
+		return Config{}, err
+	}
+	return c, nil
+}
+
+// duration 解析path字段的时间字符串，s为空时返回0
+func duration(path, s string, errs *[]string) time.Duration {
+	if s == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		*errs = append(*errs, fmt.Sprintf("%s: invalid duration %q", path, s))
+	}
+	return d
+}
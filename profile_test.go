@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseConfig(t *testing.T) {
+	c, err := ParseConfig([]byte(`{
+		"openInterval": "30s",
+		"threshold": 10,
+		"softThreshold": 5,
+		"sheddingCurve": "linear",
+		"failureRatio": 0.5,
+		"minRequests": 20,
+		"volumeWindow": {"interval": "10s", "buckets": 6},
+		"halfOpenQueue": "200ms",
+		"maxOpenDuration": "10m",
+		"staleProbeReset": "1m",
+		"halfOpenSuccessDecay": "90s",
+		"batchAggregation": "any",
+		"resetFailuresOnSuccess": false
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.OpenInterval != 30 || c.Threshold != 10 || c.SoftThreshold != 5 || c.SheddingCurve == nil ||
+		c.FailureRatio != 0.5 || c.MinRequests != 20 || c.VolumeWindowInterval != 10 || c.VolumeWindowBuckets != 6 ||
+		c.HalfOpenQueue != 200*time.Millisecond || c.MaxOpenDuration != 10*time.Minute || c.BatchAggregation != BatchAnySuccess ||
+		c.StaleProbeReset != time.Minute || c.HalfOpenSuccessDecay != 90*time.Second || c.ResetFailuresOnSuccess == nil || *c.ResetFailuresOnSuccess {
+		t.Fatalf("%+v", c)
+	}
+	cb, err := NewFromConfig("payments", c)
+	if err != nil || cb.openInterval != 30 || cb.volume == nil || cb.staleProbeReset != 60 || cb.successDecay != 90 || cb.resetFailuresOnSuccess {
+		t.Fatal(err)
+	}
+
+	// 省略的字段使用默认值
+	c, err = ParseConfig([]byte(`{}`))
+	if err != nil || c.OpenInterval != 0 || c.Threshold != 0 {
+		t.Fatal(c, err)
+	}
+}
+
+func TestParseConfigInvalid(t *testing.T) {
+	cases := []struct {
+		json string
+		want string
+	}{
+		{`{"openInterval": 30}`, "openInterval"},
+		{`{"openInterval": "30 seconds"}`, `openInterval: invalid duration "30 seconds"`},
+		{`{"window": {"interval": "1.5s", "buckets": 6}}`, "window.interval"},
+		{`{"sheddingCurve": "cubic", "softThreshold": 1}`, "sheddingCurve: unknown curve"},
+		{`{"batchAggregation": "most"}`, "batchAggregation"},
+		{`{"classifier": "unregistered"}`, `classifier: unknown classifier "unregistered"`},
+		{`{"threshhold": 5}`, "threshhold"},
+		{`{"failureRatio": 2}`, "FailureRatio must be in [0, 1]"},
+		{`{`, "invalid config"},
+	}
+	for _, c := range cases {
+		_, err := ParseConfig([]byte(c.json))
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Fatal(c.json, err)
+		}
+	}
+}
+
+func TestParseConfigClassifier(t *testing.T) {
+	RegisterClassifier("ignore-canceled", func(result interface{}, err error) Outcome {
+		switch {
+		case errors.Is(err, context.Canceled):
+			return OutcomeIgnore
+		case err != nil:
+			return OutcomeFailure
+		}
+		return OutcomeSuccess
+	})
+	c, err := ParseConfig([]byte(`{"threshold": 1, "classifier": "ignore-canceled"}`))
+	if err != nil || c.OutcomeFunc == nil {
+		t.Fatal(c, err)
+	}
+	cb, err := NewFromConfig("payments", c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := cb.ExecuteContextErr(ctx, func(ctx context.Context) error { return context.Canceled }); err != context.Canceled {
+		t.Fatal(err)
+	}
+	RequireState(t, cb, StateClosed)
+	if in := cb.Inspect(); in.Classifier != "ignore-canceled" {
+		t.Fatal(in.Classifier)
+	}
+	_ = cb.ExecuteContextErr(ctx, func(ctx context.Context) error { return errors.New("boom") })
+	RequireState(t, cb, StateOpen)
+}
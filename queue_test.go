@@ -0,0 +1,62 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerHalfOpenQueue(t *testing.T) {
+	cb := NewCircuitBreaker(60, 1, WithHalfOpenQueue(time.Second))
+	_ = fail(cb)
+	atomic.StoreInt64(&cb.openExpire, cb.now()-1)
+	// half open，探测请求执行期间其它请求排队等待
+	release := make(chan struct{})
+	probe := cb.ExecuteAsync(func() bool {
+		<-release
+		return true
+	})
+	for atomic.LoadUint32(&cb.s.requests) != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	var executed int32
+	queued := cb.ExecuteAsync(func() bool {
+		atomic.StoreInt32(&executed, 1)
+		return true
+	})
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt32(&executed) != 0 {
+		t.Fatal("queued call should wait for the probe")
+	}
+	// 探测成功后熔断器关闭，排队的请求被执行
+	close(release)
+	if err := <-probe; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-queued; err != nil || atomic.LoadInt32(&executed) != 1 {
+		t.Fatal(err, executed)
+	}
+}
+
+func TestCircuitBreakerHalfOpenQueueTimeout(t *testing.T) {
+	cb := NewCircuitBreaker(60, 1, WithHalfOpenQueue(50*time.Millisecond))
+	_ = fail(cb)
+	atomic.StoreInt64(&cb.openExpire, cb.now()-1)
+	release := make(chan struct{})
+	defer close(release)
+	_ = cb.ExecuteAsync(func() bool {
+		<-release
+		return true
+	})
+	for atomic.LoadUint32(&cb.s.requests) != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	start := time.Now()
+	err := success(cb)
+	if err != ErrTooManyRequests || time.Since(start) < 50*time.Millisecond {
+		t.Fatal(err, time.Since(start))
+	}
+	if atomic.LoadUint32(&cb.s.rejections) != 1 {
+		t.Fatal(atomic.LoadUint32(&cb.s.rejections))
+	}
+}
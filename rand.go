@@ -0,0 +1,23 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// lockedRand 并发安全的随机数生成器，rand.Rand本身不是并发安全的
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func newLockedRand(r *rand.Rand) *lockedRand {
+	return &lockedRand{r: r}
+}
+
+func (l *lockedRand) Float64() float64 {
+	l.mu.Lock()
+	f := l.r.Float64()
+	l.mu.Unlock()
+	return f
+}
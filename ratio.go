@@ -0,0 +1,43 @@
+package main
+
+import "sync/atomic"
+
+// ratioExceeded 关闭状态下失败率是否达到failureRatio
+// 配置了volume时使用窗口内的聚合数据volume，否则使用当前周期内的全部请求，参考cycleVolume
+func (cb *CircuitBreaker) ratioExceeded(volume bucket) bool {
+	if cb.failureRatio <= 0 {
+		return false
+	}
+	volume = cb.cycleVolume(volume)
+	total := volume.successes + volume.failures
+	if total == 0 || total < cb.minRequests {
+		return false
+	}
+	return float64(volume.failures)/float64(total) >= cb.failureRatio
+}
+
+// settleHalfOpen 半开启状态下按成功率判断是否恢复，与ratioExceeded使用相同的数据来源
+// 请求数达到halfOpenMinRequests后，成功率达到halfOpenSuccessRatio时关闭熔断器，否则重新开启
+func (cb *CircuitBreaker) settleHalfOpen(volume bucket, now int64) {
+	volume = cb.cycleVolume(volume)
+	total := volume.successes + volume.failures
+	if total == 0 || total < cb.halfOpenMinRequests {
+		return
+	}
+	if float64(volume.successes)/float64(total) >= cb.halfOpenSuccessRatio {
+		cb.recover(now)
+	} else {
+		cb.switchState(StateHalfOpen, StateOpen, now, ReasonHalfOpenFailure)
+	}
+}
+
+// cycleVolume 配置了volume时返回窗口内的聚合数据volume，否则返回当前周期内的全部请求
+func (cb *CircuitBreaker) cycleVolume(volume bucket) bucket {
+	if cb.volume != nil {
+		return volume
+	}
+	return bucket{
+		successes: atomic.LoadUint32(&cb.s.successes),
+		failures:  atomic.LoadUint32(&cb.s.failures),
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerFailureRatio(t *testing.T) {
+	cb := NewCircuitBreaker(60, 100, WithFailureRatio(0.5, 10))
+	now := time.Unix(1000, 0)
+	// 请求数不足时不开启
+	for i := 0; i < 4; i++ {
+		_ = cb.ExecuteAt(now, func() bool { return false })
+	}
+	for i := 0; i < 5; i++ {
+		_ = cb.ExecuteAt(now, func() bool { return true })
+	}
+	if cb.state != StateClosed {
+		t.Fatal(cb.state)
+	}
+	_ = cb.ExecuteAt(now, func() bool { return false })
+	if cb.state != StateOpen {
+		t.Fatal(cb.state)
+	}
+}
+
+func TestCircuitBreakerRequestVolumeWindow(t *testing.T) {
+	for _, windowed := range []bool{false, true} {
+		opts := []Option{WithFailureRatio(0.5, 10)}
+		if windowed {
+			opts = append(opts, WithRequestVolumeWindow(10, 6))
+		}
+		cb := NewCircuitBreaker(60, 100, opts...)
+		now := time.Unix(1000, 0)
+		// 很久之前的健康流量
+		for i := 0; i < 1000; i++ {
+			_ = cb.ExecuteAt(now, func() bool { return true })
+		}
+		// 近期的失败突增
+		now = now.Add(10 * time.Minute)
+		for i := 0; i < 30; i++ {
+			_ = cb.ExecuteAt(now, func() bool { return i%4 == 0 })
+		}
+		if windowed && cb.state != StateOpen {
+			t.Fatal(cb.state)
+		}
+		if !windowed && cb.state != StateClosed {
+			t.Fatal(cb.state)
+		}
+	}
+}
+
+func TestCircuitBreakerFailureRatioLowRate(t *testing.T) {
+	cb := NewCircuitBreaker(60, 5, WithFailureRatio(0.5, 20))
+	// 约1%的失败率，失败分散在大量成功之间，失败总数超过threshold也不应开启
+	for i := 0; i < 1000; i++ {
+		if i%100 == 0 {
+			_ = fail(cb)
+		} else {
+			_ = success(cb)
+		}
+	}
+	RequireState(t, cb, StateClosed)
+	if counts := cb.Counts(); counts.Failures != 10 || counts.ContinuousFailures != 0 {
+		t.Fatal(counts)
+	}
+}
+
+func TestCircuitBreakerResetFailuresOnSuccessRatio(t *testing.T) {
+	for _, reset := range []bool{false, true} {
+		cb := NewCircuitBreaker(60, 5, WithFailureRatio(0.9, 100), WithResetFailuresOnSuccess(reset))
+		// 失败率和请求数都达不到按失败率开启的条件，失败与成功交替出现
+		for i := 0; i < 10; i++ {
+			_ = fail(cb)
+			_ = success(cb)
+		}
+		if reset && cb.state != StateClosed {
+			t.Fatal(cb.state)
+		}
+		if !reset && cb.state != StateOpen {
+			t.Fatal(cb.state)
+		}
+	}
+	// 配置了失败率时默认清零，穿插其中的成功不会阻止按失败率开启
+	cb := NewCircuitBreaker(60, 5, WithFailureRatio(0.5, 10))
+	for i := 0; i < 5; i++ {
+		_ = fail(cb)
+		_ = success(cb)
+	}
+	RequireState(t, cb, StateClosed)
+	_ = fail(cb)
+	RequireState(t, cb, StateOpen)
+	// 只按连续失败开启时默认清零
+	cb = NewCircuitBreaker(60, 3)
+	for i := 0; i < 3; i++ {
+		_ = fail(cb)
+		_ = success(cb)
+	}
+	if cb.state != StateClosed {
+		t.Fatal(cb.state)
+	}
+}
+
+func TestCircuitBreakerResetFailuresOnSuccess(t *testing.T) {
+	if cb := NewCircuitBreaker(60, 3); !cb.resetFailuresOnSuccess {
+		t.Fatal("reset on success is not the default")
+	}
+	// 配置为false时穿插其中的成功不再阻止开启
+	for _, reset := range []bool{false, true} {
+		cb := NewCircuitBreaker(60, 3, WithResetFailuresOnSuccess(reset))
+		for i := 0; i < 3; i++ {
+			_ = fail(cb)
+			_ = success(cb)
+		}
+		if reset && cb.state != StateClosed {
+			t.Fatal(cb.state)
+		}
+		if !reset && cb.state != StateOpen {
+			t.Fatal(cb.state)
+		}
+	}
+}
+
+func TestCircuitBreakerHalfOpenSuccessRatio(t *testing.T) {
+	for _, c := range []struct {
+		every int // 每every个请求失败一次
+		want  uint32
+	}{
+		{10, StateClosed}, // 有少量失败但正在恢复
+		{2, StateOpen},
+	} {
+		cb := NewCircuitBreaker(60, 5, WithHalfOpenSuccessRatio(0.8, 20))
+		DriveToHalfOpen(cb)
+		for i := 0; i < 19; i++ {
+			if err := cb.Execute(func() bool { return i%c.every != 0 }); err != nil {
+				t.Fatal(i, err)
+			}
+		}
+		// 样本不足时不做判断
+		RequireState(t, cb, StateHalfOpen)
+		_ = success(cb)
+		RequireState(t, cb, c.want)
+	}
+	// 未配置时一次失败就重新开启
+	cb := NewCircuitBreaker(60, 5)
+	DriveToHalfOpen(cb)
+	_ = fail(cb)
+	RequireState(t, cb, StateOpen)
+}
@@ -0,0 +1,87 @@
+package main
+
+// Reason 熔断器状态切换的原因
+type Reason uint32
+
+const (
+	ReasonThreshold           Reason = 1  // 关闭->开启：失败数达到阈值
+	ReasonIntervalElapsed     Reason = 2  // 开启->半开启：经过了openInterval
+	ReasonHalfOpenFailure     Reason = 3  // 半开启->开启：探测请求失败
+	ReasonHalfOpenRecovered   Reason = 4  // 半开启->关闭：探测请求连续成功达到阈值
+	ReasonOpenRecovered       Reason = 5  // 开启->半开启：开启状态下ExecuteBypass或WithOpenSampling放行的请求连续成功达到阈值
+	ReasonManual              Reason = 6  // 手动切换状态
+	ReasonProbeTimeout        Reason = 7  // 半开启->开启：探测请求超时未返回
+	ReasonMaxOpenDuration     Reason = 8  // 开启->半开启：开启状态持续超过了WithMaxOpenDuration配置的时间
+	ReasonSlowCalls           Reason = 9  // 关闭->开启：连续慢调用达到阈值
+	ReasonHealthCheck         Reason = 10 // 半开启->开启：WithBaselineHealthCheck配置的健康检查失败
+	ReasonMaxHalfOpenDuration Reason = 11 // 半开启->开启或关闭：半开启状态持续超过了WithMaxHalfOpenDuration配置的时间
+)
+
+func (r Reason) String() string {
+	switch r {
+	case ReasonThreshold:
+		return "threshold"
+	case ReasonIntervalElapsed:
+		return "interval_elapsed"
+	case ReasonHalfOpenFailure:
+		return "half_open_failure"
+	case ReasonHalfOpenRecovered:
+		return "half_open_recovered"
+	case ReasonOpenRecovered:
+		return "open_recovered"
+	case ReasonManual:
+		return "manual"
+	case ReasonProbeTimeout:
+		return "probe_timeout"
+	case ReasonMaxOpenDuration:
+		return "max_open_duration"
+	case ReasonSlowCalls:
+		return "slow_calls"
+	case ReasonHealthCheck:
+		return "health_check"
+	case ReasonMaxHalfOpenDuration:
+		return "max_half_open_duration"
+	default:
+		return "unknown"
+	}
+}
+
+// OpenCause 熔断器处于开启状态的原因，用于区分需要不同告警方式的开启
+type OpenCause uint32
+
+const (
+	CauseNone     OpenCause = 0 // 熔断器不处于开启状态
+	CauseFailures OpenCause = 1 // 关闭状态下失败(或慢调用)达到阈值
+	CauseManual   OpenCause = 2 // 通过Trip手动开启
+	CauseBackoff  OpenCause = 3 // 半开启状态下恢复失败，重新开启退避
+)
+
+// Cause 返回以r为原因切换到开启状态时的OpenCause，r不是切换到开启状态的原因时返回CauseNone
+// 自定义TransitionStrategy返回的原因同样按此对应
+func (r Reason) Cause() OpenCause {
+	switch r {
+	case ReasonThreshold, ReasonSlowCalls:
+		return CauseFailures
+	case ReasonManual:
+		return CauseManual
+	case ReasonHalfOpenFailure, ReasonProbeTimeout, ReasonHealthCheck, ReasonMaxHalfOpenDuration:
+		return CauseBackoff
+	default:
+		return CauseNone
+	}
+}
+
+func (c OpenCause) String() string {
+	switch c {
+	case CauseNone:
+		return "none"
+	case CauseFailures:
+		return "failures"
+	case CauseManual:
+		return "manual"
+	case CauseBackoff:
+		return "backoff"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type transition struct {
+	from, to uint32
+	reason   Reason
+}
+
+func TestCircuitBreakerStateChangeReason(t *testing.T) {
+	var got []transition
+	cb := NewCircuitBreaker(10, 2, WithName("payments"), WithOnStateChange(func(name string, from, to uint32, reason Reason, counts Counts) {
+		if name != "payments" {
+			t.Fatal(name)
+		}
+		got = append(got, transition{from, to, reason})
+	}))
+	now := time.Now()
+	ok := func() bool { return true }
+	ko := func() bool { return false }
+	// closed -> open
+	_ = cb.ExecuteAt(now, ko)
+	_ = cb.ExecuteAt(now, ko)
+	// open -> half open -> open
+	now = now.Add(11 * time.Second)
+	_ = cb.ExecuteAt(now, ko)
+	// open -> half open (bypass) -> closed
+	_, _ = cb.ExecuteBypass(ok)
+	_, _ = cb.ExecuteBypass(ok)
+	now = now.Add(time.Second)
+	_ = cb.ExecuteAt(now, ok)
+	_ = cb.ExecuteAt(now, ok)
+
+	want := []transition{
+		{StateClosed, StateOpen, ReasonThreshold},
+		{StateOpen, StateHalfOpen, ReasonIntervalElapsed},
+		{StateHalfOpen, StateOpen, ReasonHalfOpenFailure},
+		{StateOpen, StateHalfOpen, ReasonOpenRecovered},
+		{StateHalfOpen, StateClosed, ReasonHalfOpenRecovered},
+	}
+	if len(got) != len(want) {
+		t.Fatal(got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatal(i, got[i], want[i])
+		}
+	}
+}
+
+func TestReasonString(t *testing.T) {
+	if ReasonThreshold.String() != "threshold" || Reason(0).String() != "unknown" {
+		t.Fatal(ReasonThreshold, Reason(0))
+	}
+}
+
+func TestCircuitBreakerStateChangeCounts(t *testing.T) {
+	var got []Counts
+	cb := NewCircuitBreaker(10, 3, WithOnStateChange(func(name string, from, to uint32, reason Reason, counts Counts) {
+		got = append(got, counts)
+	}))
+	_ = success(cb)
+	for i := 0; i < 3; i++ {
+		_ = fail(cb)
+	}
+	want := Counts{Requests: 4, ContinuousFailures: 3, Successes: 1, Failures: 3}
+	if len(got) != 1 || got[0] != want {
+		t.Fatal(got)
+	}
+	// 回调之后统计数据被清空
+	if cb.Counts() != (Counts{}) {
+		t.Fatal(cb.Counts())
+	}
+}
+
+func TestCircuitBreakerOpenCause(t *testing.T) {
+	var reasons []Reason
+	cb := NewCircuitBreaker(10, 2, WithOnStateChange(func(name string, from, to uint32, reason Reason, counts Counts) {
+		reasons = append(reasons, reason)
+	}))
+	if cb.OpenCause() != CauseNone {
+		t.Fatal(cb.OpenCause())
+	}
+	DriveToOpen(cb)
+	if cb.OpenCause() != CauseFailures {
+		t.Fatal(cb.OpenCause())
+	}
+	DriveToHalfOpen(cb)
+	if cb.OpenCause() != CauseNone {
+		t.Fatal(cb.OpenCause())
+	}
+	_ = fail(cb)
+	if cb.OpenCause() != CauseBackoff {
+		t.Fatal(cb.OpenCause())
+	}
+
+	cb.Reset()
+	reasons = nil
+	cb.Trip()
+	RequireState(t, cb, StateOpen)
+	if cb.OpenCause() != CauseManual || len(reasons) != 1 || reasons[0] != ReasonManual || reasons[0].Cause() != CauseManual {
+		t.Fatal(cb.OpenCause(), reasons)
+	}
+	// 已经开启时不再切换
+	cb.Trip()
+	if len(reasons) != 1 {
+		t.Fatal(reasons)
+	}
+	if CauseManual.String() != "manual" || ReasonIntervalElapsed.Cause() != CauseNone {
+		t.Fatal(CauseManual, ReasonIntervalElapsed.Cause())
+	}
+}
+
+func TestCircuitBreakerTripRace(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		var opened int32
+		// 固定的时钟，避免Trip和断言之间跨过秒的边界
+		now := time.Unix(1000, 0)
+		cb := NewCircuitBreaker(60, 3, WithClock(func() time.Time { return now }),
+			WithOnStateChange(func(name string, from, to uint32, reason Reason, counts Counts) {
+				atomic.AddInt32(&opened, 1)
+			}))
+		var wg sync.WaitGroup
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for k := 0; k < 3; k++ {
+					_ = cb.Execute(func() bool { return false })
+				}
+			}()
+		}
+		var tripped bool
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tripped = cb.Trip()
+		}()
+		wg.Wait()
+		// 只有一次状态切换，只进入一个新的周期
+		stats := cb.SnapshotStats()
+		if opened != 1 || stats.State != StateOpen || stats.Generation != 1 || stats.Counts != (Counts{}) {
+			t.Fatal(opened, stats)
+		}
+		if tripped && cb.OpenCause() != CauseManual || !tripped && cb.OpenCause() != CauseFailures {
+			t.Fatal(tripped, cb.OpenCause())
+		}
+		if cb.openExpire != 1060 {
+			t.Fatal(cb.openExpire)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import "sync"
+
+// defaultRecentErrors 未配置WithRecentErrors时保存的错误数，只保存最近一次的错误
+const defaultRecentErrors = 1
+
+// recentErrors 保存最近几次失败的错误的环形缓冲
+type recentErrors struct {
+	mu   sync.Mutex
+	errs []error
+	// next 下一个错误写入的位置
+	next int
+	full bool
+}
+
+func newRecentErrors(size int) *recentErrors {
+	return &recentErrors{errs: make([]error, size)}
+}
+
+func (r *recentErrors) add(err error) {
+	r.mu.Lock()
+	r.errs[r.next] = err
+	r.next++
+	if r.next == len(r.errs) {
+		r.next = 0
+		r.full = true
+	}
+	r.mu.Unlock()
+}
+
+// list 按从旧到新的顺序返回保存的错误
+func (r *recentErrors) list() []error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]error(nil), r.errs[:r.next]...)
+	}
+	return append(append([]error(nil), r.errs[r.next:]...), r.errs[:r.next]...)
+}
+
+// recordError 记录一次计为失败的请求的错误，err为nil时不记录
+func (cb *CircuitBreaker) recordError(err error) {
+	if err != nil {
+		cb.recent.add(err)
+	}
+}
+
+// LastError 返回最近一次计为失败的请求的错误，没有时返回nil
+// 只有能够得到错误的执行方式会记录错误：ExecuteResult、Do、ExecuteWithCache，以及配置了WithErrorPredicate时的Execute等方法
+func (cb *CircuitBreaker) LastError() error {
+	errs := cb.RecentErrors()
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs[len(errs)-1]
+}
+
+// RecentErrors 按从旧到新的顺序返回最近几次计为失败的请求的错误，最多保存WithRecentErrors配置的个数，默认只保存最近一次
+// 记录错误的执行方式参考LastError，返回的切片由调用方持有
+func (cb *CircuitBreaker) RecentErrors() []error {
+	return cb.recent.list()
+}
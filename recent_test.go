@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestCircuitBreakerRecentErrors(t *testing.T) {
+	cb := NewCircuitBreaker(60, 100, WithRecentErrors(3))
+	if cb.LastError() != nil || len(cb.RecentErrors()) != 0 {
+		t.Fatal(cb.LastError(), cb.RecentErrors())
+	}
+	var errs []error
+	for i := 0; i < 5; i++ {
+		err := fmt.Errorf("error %d", i)
+		errs = append(errs, err)
+		_ = cb.ExecuteResult(func() (bool, error) { return false, err })
+		if i == 1 && !reflect.DeepEqual(cb.RecentErrors(), errs) {
+			t.Fatal(cb.RecentErrors())
+		}
+	}
+	// 成功的请求即使返回错误也不记录
+	_ = cb.ExecuteResult(func() (bool, error) { return true, errors.New("ignored") })
+	if got := cb.RecentErrors(); !reflect.DeepEqual(got, errs[2:]) {
+		t.Fatal(got)
+	}
+	if cb.LastError() != errs[4] {
+		t.Fatal(cb.LastError())
+	}
+
+	// 默认只保存最近一次的错误
+	var captured error
+	cb = NewCircuitBreaker(60, 100, WithErrorPredicate(func() error { return captured }, func(err error) bool { return true }))
+	for i := 0; i < 3; i++ {
+		captured = fmt.Errorf("error %d", i)
+		_ = fail(cb)
+	}
+	if got := cb.RecentErrors(); len(got) != 1 || got[0] != captured || cb.LastError() != captured {
+		t.Fatal(got)
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import "sync/atomic"
+
+// Reserve 与Allowable不同，进行完整的放行判断并占用名额(半开启状态下的探测名额、WithMaxConcurrency的并发名额等)，请求被拒绝时返回对应的错误
+// 并发名额已满时返回ErrConcurrencyLimit，放行的请求在调用release之前一直占用一个并发名额
+// 放行时返回release，实际的工作完成后调用release报告结果，结果按放行时的周期计入统计，与Execute相同；
+// release只有第一次调用生效，之后的调用被忽略，因此名额只会被归还一次。放行后一直不调用release时名额一直被占用，
+// 可以配合WithProbeTimeout或WithStaleProbeReset避免半开启状态卡住
+func (cb *CircuitBreaker) Reserve() (release func(success bool), err error) {
+	cycle, err := cb.beforeExecute(cb.now())
+	if err != nil {
+		return nil, err
+	}
+	var released uint32
+	return func(success bool) {
+		if atomic.CompareAndSwapUint32(&released, 0, 1) {
+			cb.afterExecute(cycle, success, cb.now())
+			cb.leaveConcurrency()
+		}
+	}, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestCircuitBreakerReserve(t *testing.T) {
+	cb := NewCircuitBreaker(60, 2)
+	release, err := cb.Reserve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cb.Counts().Requests != 1 {
+		t.Fatal(cb.Counts())
+	}
+	// 多次调用release只计入一次
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release(false)
+		}()
+	}
+	wg.Wait()
+	if c := cb.Counts(); c.Failures != 1 || c.Requests != 1 {
+		t.Fatal(c)
+	}
+	RequireState(t, cb, StateClosed)
+
+	// 半开启状态下预留的名额计入探测名额
+	DriveToHalfOpen(cb)
+	first, err := cb.Reserve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := cb.Reserve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cb.Reserve(); err != ErrTooManyRequests {
+		t.Fatal(err)
+	}
+	first(true)
+	first(false)
+	RequireState(t, cb, StateHalfOpen)
+	second(true)
+	RequireState(t, cb, StateClosed)
+
+	DriveToOpen(cb)
+	if release, err := cb.Reserve(); release != nil || err != ErrOpenState {
+		t.Fatal(err)
+	}
+}
+
+func TestCircuitBreakerReserveMaxConcurrency(t *testing.T) {
+	cb := NewCircuitBreaker(60, 5, WithMaxConcurrency(2))
+	first, err := cb.Reserve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := cb.Reserve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 预留的名额和Execute共用同一个并发上限
+	if release, err := cb.Reserve(); release != nil || err != ErrConcurrencyLimit {
+		t.Fatal(err)
+	}
+	if err := success(cb); err != ErrConcurrencyLimit {
+		t.Fatal(err)
+	}
+	if n := cb.InFlight(); n != 2 {
+		t.Fatal(n)
+	}
+
+	// 多次调用release只归还一个名额
+	for i := 0; i < 3; i++ {
+		first(true)
+	}
+	if n := cb.InFlight(); n != 1 {
+		t.Fatal(n)
+	}
+	third, err := cb.Reserve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cb.Reserve(); err != ErrConcurrencyLimit {
+		t.Fatal(err)
+	}
+	second(true)
+	third(false)
+	if n := cb.InFlight(); n != 0 {
+		t.Fatal(n)
+	}
+	if c := cb.Counts(); c.Requests != 3 || c.Successes != 2 || c.Failures != 1 {
+		t.Fatal(c)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import "time"
+
+// RetryPolicy ExecuteWithRetry的重试策略
+type RetryPolicy struct {
+	// MaxAttempts 最多执行f的次数，包括第一次，小于1时视为1
+	MaxAttempts int
+	// Backoff 两次执行之间等待的时间，0表示立即重试
+	Backoff time.Duration
+}
+
+// ExecuteWithRetry 与Execute相同，放行的请求失败后按policy重试，直到成功、达到MaxAttempts或请求被熔断器拒绝
+// 每一次重试都经过熔断器的放行判断并计入统计，重试过程中熔断器开启时立即停止重试并返回ErrOpenState等拒绝时的错误，
+// 避免重试穿过正在开启的熔断器，也不会在半开启状态下用重试耗尽探测名额
+// 达到MaxAttempts后返回值与Execute中请求失败时相同
+func (cb *CircuitBreaker) ExecuteWithRetry(f func() bool, policy RetryPolicy) error {
+	for attempt := 1; ; attempt++ {
+		r := cb.Call(f)
+		if !r.Admitted || r.Success || attempt >= policy.MaxAttempts {
+			return r.Err
+		}
+		// 熔断器已经开启时下一次执行必然被拒绝，不必再等待
+		if policy.Backoff > 0 && cb.State() != StateOpen {
+			time.Sleep(policy.Backoff)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerExecuteWithRetry(t *testing.T) {
+	cb := NewCircuitBreaker(60, 5)
+	calls := 0
+	err := cb.ExecuteWithRetry(func() bool {
+		calls++
+		return calls == 3
+	}, RetryPolicy{MaxAttempts: 5})
+	if err != nil || calls != 3 {
+		t.Fatal(err, calls)
+	}
+
+	calls = 0
+	err = cb.ExecuteWithRetry(func() bool {
+		calls++
+		return false
+	}, RetryPolicy{MaxAttempts: 2})
+	if err != nil || calls != 2 {
+		t.Fatal(err, calls)
+	}
+	RequireState(t, cb, StateClosed)
+
+	cb = NewCircuitBreaker(60, 5, WithCallFailedError(ErrCallFailed))
+	err = cb.ExecuteWithRetry(func() bool { return false }, RetryPolicy{})
+	if err != ErrCallFailed {
+		t.Fatal(err)
+	}
+}
+
+func TestCircuitBreakerExecuteWithRetryStopsWhenOpen(t *testing.T) {
+	cb := NewCircuitBreaker(60, 3)
+	calls := 0
+	start := time.Now()
+	err := cb.ExecuteWithRetry(func() bool {
+		calls++
+		return false
+	}, RetryPolicy{MaxAttempts: 10, Backoff: 10 * time.Millisecond})
+	if err != ErrOpenState || calls != 3 {
+		t.Fatal(err, calls)
+	}
+	// 第三次失败后熔断器开启，不再等待
+	if elapsed := time.Since(start); elapsed >= 30*time.Millisecond {
+		t.Fatal(elapsed)
+	}
+
+	// 半开启状态下探测失败后熔断器重新开启，重试不再占用探测名额
+	DriveToHalfOpen(cb)
+	calls = 0
+	err = cb.ExecuteWithRetry(func() bool {
+		calls++
+		return false
+	}, RetryPolicy{MaxAttempts: 10})
+	if err != ErrOpenState || calls != 1 {
+		t.Fatal(err, calls)
+	}
+	RequireState(t, cb, StateOpen)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// samplingRands 抽样记录请求结果使用的随机数生成器
+// 抽样的目的是减少请求之间对共享数据的竞争，因此不使用带锁的cb.rand，而是每个P各自使用一个生成器
+var samplingRands = sync.Pool{
+	New: func() interface{} {
+		return rand.New(rand.NewSource(time.Now().UnixNano()))
+	},
+}
+
+// samplingWeight rate为1/n(n为不小于2的整数)时返回n，否则返回false
+func samplingWeight(rate float64) (uint32, bool) {
+	if rate <= 0 || rate > 0.5 {
+		return 0, false
+	}
+	n := math.Round(1 / rate)
+	if n > math.MaxUint32 || math.Abs(n*rate-1) > 1e-9 {
+		return 0, false
+	}
+	return uint32(n), true
+}
+
+// sampleObservation 以1/weight的概率返回true
+func sampleObservation(weight uint32) bool {
+	r := samplingRands.Get().(*rand.Rand)
+	sampled := r.Int63n(int64(weight)) == 0
+	samplingRands.Put(r)
+	return sampled
+}
+
+// observationSampled 关闭状态下是否抽样记录请求结果，只有按失败率开启并且使用内置的状态切换规则时抽样
+func (cb *CircuitBreaker) observationSampled() bool {
+	return cb.observationWeight > 1 && cb.failureRatio > 0 && cb.strategy == nil
+}
+
+// observeSampled 关闭状态下以1/observationWeight的概率记录一次结果，被抽中的结果按observationWeight次计入成功数、失败数和失败率，
+// 使按失败率的判断仍然代表全部请求；没有被抽中的结果不修改任何统计数据
+func (cb *CircuitBreaker) observeSampled(success bool, now int64) {
+	if !sampleObservation(cb.observationWeight) {
+		return
+	}
+	n := cb.observationWeight
+	if success {
+		atomic.AddUint32(&cb.s.successes, n)
+		if cb.volume != nil {
+			cb.volume.recordN(now, true, n)
+		}
+		return
+	}
+	atomic.AddUint32(&cb.s.failures, n)
+	var volume bucket
+	if cb.volume != nil {
+		volume = cb.volume.recordN(now, false, n)
+	}
+	if cb.ratioExceeded(volume) && !cb.inStartupGrace(now) {
+		cb.switchState(StateClosed, StateOpen, now, ReasonThreshold)
+	}
+}
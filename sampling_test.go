@@ -0,0 +1,88 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerObservationSampling(t *testing.T) {
+	cb := NewCircuitBreaker(60, 1000, WithFailureRatio(0.5, 1000), WithObservationSampling(0.1))
+	const n = 50000
+	for i := 0; i < n; i++ {
+		if i%10 < 3 {
+			_ = fail(cb)
+		} else {
+			_ = success(cb)
+		}
+	}
+	RequireState(t, cb, StateClosed)
+	// 请求数和累计的结果不抽样
+	counts := cb.Counts()
+	if m := cb.Metrics(); counts.Requests != n || m.Successes != n*7/10 || m.Failures != n*3/10 {
+		t.Fatal(counts, m)
+	}
+	// 按权重放大之后的总数和失败率接近全部请求，允许的误差约为6倍标准差
+	total := float64(counts.Successes + counts.Failures)
+	if math.Abs(total-n) > n/10 {
+		t.Fatal(counts)
+	}
+	if ratio := float64(counts.Failures) / total; math.Abs(ratio-0.3) > 0.04 {
+		t.Fatal(ratio, counts)
+	}
+
+	// 抽样的失败率达到阈值时开启
+	for i := 0; cb.State() == StateClosed; i++ {
+		if i == n {
+			t.Fatal("not tripped", cb.Counts())
+		}
+		_ = fail(cb)
+	}
+	RequireState(t, cb, StateOpen)
+
+	// 半开启状态下不抽样，一次失败就重新开启
+	advance(cb, 61*time.Second)
+	RequireState(t, cb, StateHalfOpen)
+	_ = fail(cb)
+	RequireState(t, cb, StateOpen)
+}
+
+func TestObservationSamplingRate(t *testing.T) {
+	for rate, want := range map[float64]uint32{0.5: 2, 0.25: 4, 0.1: 10, 0.01: 100, 1.0 / 3: 3, 0.6: 0, 0.75: 0, 0.3: 0, 1: 0, 0: 0, -0.5: 0} {
+		if cb := NewCircuitBreaker(60, 5, WithObservationSampling(rate)); cb.observationWeight != want {
+			t.Fatal(rate, cb.observationWeight)
+		}
+	}
+	if err := (Config{FailureRatio: 0.5, ObservationSampling: 0.75}).Validate(); err == nil || !strings.Contains(err.Error(), "1/n") {
+		t.Fatal(err)
+	}
+	if err := (Config{FailureRatio: 0.5, ObservationSampling: 0.1}).Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// BenchmarkExecuteObservationSampling 对比全部记录和抽样记录时并发执行请求的耗时
+// 单核上读取时钟的耗时占主导，两者差别不大；抽样对多个CPU之间竞争的影响需要在多核机器上以-cpu 1,8,32等参数测量
+func BenchmarkExecuteObservationSampling(b *testing.B) {
+	for _, c := range []struct {
+		name string
+		opts []Option
+	}{
+		{"exact", nil},
+		{"sampled", []Option{WithObservationSampling(0.01)}},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			opts := append([]Option{WithFailureRatio(0.5, 100), WithRequestVolumeWindow(10, 6)}, c.opts...)
+			cb := NewCircuitBreaker(60, 5, opts...)
+			ok := func() bool { return true }
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					_ = cb.Execute(ok)
+				}
+			})
+		})
+	}
+}
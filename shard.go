@@ -0,0 +1,34 @@
+package main
+
+import "sync"
+
+// probeShards 半开启状态下按分片记录探测请求的成功，参考WithThreadLocalProbe
+type probeShards struct {
+	mu        sync.Mutex
+	shard     func() string
+	required  int
+	succeeded map[string]struct{}
+}
+
+func newProbeShards(shard func() string, required int) *probeShards {
+	return &probeShards{
+		shard:     shard,
+		required:  required,
+		succeeded: make(map[string]struct{}),
+	}
+}
+
+// success 记录当前请求所在分片的一次成功，返回是否已经有足够多不同的分片成功
+func (p *probeShards) success() bool {
+	id := p.shard()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.succeeded[id] = struct{}{}
+	return len(p.succeeded) >= p.required
+}
+
+func (p *probeShards) clear() {
+	p.mu.Lock()
+	p.succeeded = make(map[string]struct{})
+	p.mu.Unlock()
+}
@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestCircuitBreakerThreadLocalProbe(t *testing.T) {
+	var shard string
+	cb := NewCircuitBreaker(60, 2, WithThreadLocalProbe(func() string { return shard }, 2))
+	DriveToHalfOpen(cb)
+	shard = "a"
+	// 只有一个分片成功时不关闭，并且不会占满探测名额
+	for i := 0; i < 5; i++ {
+		if err := success(cb); err != nil {
+			t.Fatal(i, err)
+		}
+	}
+	RequireState(t, cb, StateHalfOpen)
+	shard = "b"
+	_ = success(cb)
+	RequireState(t, cb, StateClosed)
+
+	// 重新进入半开启状态时清空已经成功的分片
+	DriveToHalfOpen(cb)
+	_ = success(cb)
+	_ = success(cb)
+	RequireState(t, cb, StateHalfOpen)
+}
@@ -0,0 +1,27 @@
+package main
+
+// SharedStatistic 多个熔断器共享的失败统计，例如同一个下游的多个接口各自使用一个熔断器，
+// 但下游整体出现故障时希望它们一起开启
+// 共享的只是关闭状态下的失败统计，状态机、开启周期和半开启状态下的探测仍然是每个熔断器独立的
+//
+// 并发安全：共享统计由一把互斥锁保护，所有共享它的熔断器的关闭状态请求都会竞争这把锁，
+// 熔断器数量很多且请求量很大时锁会成为瓶颈；各熔断器自身的计数仍然是无锁的原子操作
+type SharedStatistic struct {
+	window *bucketedWindow
+}
+
+// NewSharedStatistic 创建共享的失败统计，统计使用n个时间跨度为interval秒的桶组成的滑动窗口，
+// 失败随时间移出窗口，而不会因为某个熔断器切换状态被清空
+// interval或n小于等于0时返回nil，WithSharedStatistic(nil)不生效
+func NewSharedStatistic(interval int64, n int) *SharedStatistic {
+	if interval <= 0 || n <= 0 {
+		return nil
+	}
+	return &SharedStatistic{window: newBucketedWindow(interval, n)}
+}
+
+// sharedTripped 关闭状态下共享统计中的失败数是否已经达到熔断器自己的阈值
+// 其他熔断器记录的失败使共享统计达到阈值时，本熔断器在下一次被访问时开启
+func (cb *CircuitBreaker) sharedTripped(now int64) bool {
+	return cb.shared.window.aggregate(now).failures >= cb.threshold
+}
@@ -0,0 +1,19 @@
+package main
+
+import "sync/atomic"
+
+// 熔断器的生命周期与熔断器的状态是两回事：StateClosed表示熔断器关闭、放行所有请求，
+// 而Shutdown表示熔断器本身停止使用。为了避免混淆，生命周期相关的方法和错误都使用Shutdown命名
+
+// Shutdown 停止使用熔断器，之后Execute、ExecuteContext等方法不再执行f，直接返回ErrShutdown，
+// 正在等待的WaitForState同样返回ErrShutdown。State仍然返回停止时的状态，可以重复调用
+func (cb *CircuitBreaker) Shutdown() {
+	if atomic.CompareAndSwapUint32(&cb.shutdown, 0, 1) {
+		cb.watchers.notify()
+	}
+}
+
+// IsShutdown 返回熔断器是否已经通过Shutdown停止使用，与熔断器是否处于StateClosed无关
+func (cb *CircuitBreaker) IsShutdown() bool {
+	return atomic.LoadUint32(&cb.shutdown) == 1
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerShutdown(t *testing.T) {
+	cb := NewCircuitBreaker(60, 2)
+	_ = fail(cb)
+	_ = fail(cb)
+	RequireState(t, cb, StateOpen)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	waited := make(chan error, 1)
+	go func() {
+		waited <- cb.WaitForState(ctx, StateClosed)
+	}()
+
+	if cb.IsShutdown() {
+		t.Fatal(cb.IsShutdown())
+	}
+	cb.Shutdown()
+	cb.Shutdown()
+	if !cb.IsShutdown() {
+		t.Fatal(cb.IsShutdown())
+	}
+	if err := <-waited; err != ErrShutdown {
+		t.Fatal(err)
+	}
+	// 停止使用后State返回最后的状态
+	RequireState(t, cb, StateOpen)
+
+	cb.Reset()
+	RequireState(t, cb, StateClosed)
+	called := false
+	if err := cb.Execute(func() bool { called = true; return true }); err != ErrShutdown {
+		t.Fatal(err)
+	}
+	if err := cb.ExecuteContext(context.Background(), func(context.Context) bool { called = true; return true }); err != ErrShutdown {
+		t.Fatal(err)
+	}
+	if r := cb.Call(func() bool { called = true; return true }); r.Err != ErrShutdown || r.Admitted {
+		t.Fatal(r)
+	}
+	if called || cb.Metrics().Rejections != 0 {
+		t.Fatal(called, cb.Metrics())
+	}
+}
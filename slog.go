@@ -0,0 +1,39 @@
+//go:build go1.21
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// WithSlog 状态切换成功后通过logger输出一条结构化日志，日志的属性包括
+// name、from、to、reason、consecutiveFailures，切换到开启状态时还包括reopenIn
+// 属性以键值对的形式交给logger的Handler，可以直接按to=open等条件检索和告警
+func WithSlog(logger *slog.Logger) Option {
+	return func(cb *CircuitBreaker) {
+		if logger == nil {
+			return
+		}
+		cb.logTransition = func(from, to uint32, reason Reason, counts Counts) {
+			level := slog.LevelInfo
+			if to == StateOpen {
+				level = slog.LevelWarn
+			}
+			attrs := []slog.Attr{
+				slog.String("name", cb.name),
+				slog.String("from", StateString(from)),
+				slog.String("to", StateString(to)),
+				slog.String("reason", reason.String()),
+				slog.Uint64("consecutiveFailures", uint64(counts.ContinuousFailures)),
+			}
+			if to == StateOpen {
+				reopenIn := atomic.LoadInt64(&cb.openExpire) - cb.now()
+				attrs = append(attrs, slog.Duration("reopenIn", time.Duration(reopenIn)*time.Second))
+			}
+			logger.LogAttrs(context.Background(), level, "circuit breaker state changed", attrs...)
+		}
+	}
+}
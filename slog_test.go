@@ -0,0 +1,57 @@
+//go:build go1.21
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// recordingHandler 记录所有日志
+type recordingHandler struct {
+	records []slog.Record
+}
+
+func (h *recordingHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *recordingHandler) Handle(_ context.Context, r slog.Record) error {
+	h.records = append(h.records, r)
+	return nil
+}
+
+func (h *recordingHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *recordingHandler) WithGroup(string) slog.Handler { return h }
+
+func TestCircuitBreakerSlog(t *testing.T) {
+	h := &recordingHandler{}
+	cb := NewCircuitBreaker(10, 2, WithName("payments"), WithSlog(slog.New(h)))
+	DriveToOpen(cb)
+	if len(h.records) != 1 {
+		t.Fatal(len(h.records))
+	}
+	r := h.records[0]
+	if r.Level != slog.LevelWarn {
+		t.Fatal(r.Level)
+	}
+	attrs := map[string]slog.Value{}
+	r.Attrs(func(a slog.Attr) bool {
+		attrs[a.Key] = a.Value
+		return true
+	})
+	want := map[string]interface{}{
+		"name":                "payments",
+		"from":                "closed",
+		"to":                  "open",
+		"reason":              "threshold",
+		"consecutiveFailures": uint64(2),
+		"reopenIn":            10 * time.Second,
+	}
+	for k, v := range want {
+		if attrs[k].Any() != v {
+			t.Fatal(k, attrs[k])
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// timed 是否需要测量放行的请求的执行耗时
+func (cb *CircuitBreaker) timed() bool {
+	return cb.slowCallDuration > 0 || cb.latency != nil || cb.onLatency != nil
+}
+
+// slowStart 配置了慢调用检测或WithLatencyObserver时按熔断器的时钟返回开始执行f的时间，否则返回零值，避免未配置时读取时钟
+func (cb *CircuitBreaker) slowStart() time.Time {
+	if !cb.timed() {
+		return time.Time{}
+	}
+	return cb.clock()
+}
+
+// observeLatency 将一次从start开始执行、结果为success的请求的耗时交给onLatency，并记录是否为慢调用，
+// 关闭状态下连续慢调用达到slowCallCount时熔断器开启，与请求成功与否无关
+// 耗时按熔断器的时钟计算(参考WithClock)，start为零值时不做任何操作，熔断器已经进入新的周期时不再记录慢调用
+func (cb *CircuitBreaker) observeLatency(cycle uint32, start time.Time, now int64, success bool) {
+	if start.IsZero() {
+		return
+	}
+	elapsed := cb.clock().Sub(start)
+	if cb.onLatency != nil {
+		cb.onLatency(cb.name, success, elapsed)
+	}
+	if cb.slowCallDuration <= 0 && cb.latency == nil {
+		return
+	}
+	state, newCycle := cb.refreshState(now)
+	if state != StateClosed || cycle != newCycle {
+		return
+	}
+	slow := cb.slowCallDuration
+	if cb.latency != nil {
+		// 先按之前的样本判断，再把本次耗时加入样本
+		slow = cb.latency.current()
+		cb.latency.record(elapsed)
+		if slow == 0 {
+			return
+		}
+	}
+	if elapsed < slow {
+		atomic.StoreUint32(&cb.s.continuousSlowCalls, 0)
+		return
+	}
+	if saturatingIncrement(&cb.s.continuousSlowCalls, cb.slowCallCount) >= cb.slowCallCount && !cb.inStartupGrace(now) {
+		cb.switchState(StateClosed, StateOpen, now, ReasonSlowCalls)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerConsecutiveSlowCalls(t *testing.T) {
+	var reason Reason
+	cb := NewCircuitBreaker(60, 5,
+		WithTripOnConsecutiveSlowCalls(10*time.Millisecond, 3),
+		WithOnStateChange(func(name string, from, to uint32, r Reason, counts Counts) { reason = r }))
+	slow := func() bool {
+		time.Sleep(15 * time.Millisecond)
+		return true
+	}
+	_ = cb.Execute(slow)
+	_ = cb.Execute(slow)
+	if cb.Counts().ContinuousSlowCalls != 2 {
+		t.Fatal(cb.Counts())
+	}
+	// 耗时正常的请求清零连续慢调用数
+	_ = success(cb)
+	if cb.Counts().ContinuousSlowCalls != 0 {
+		t.Fatal(cb.Counts())
+	}
+	// 所有请求都成功，但连续慢调用达到阈值
+	for i := 0; i < 3; i++ {
+		_ = cb.Execute(slow)
+	}
+	RequireState(t, cb, StateOpen)
+	if reason != ReasonSlowCalls || cb.Metrics().Failures != 0 {
+		t.Fatal(reason, cb.Metrics())
+	}
+}
+
+func TestCircuitBreakerLatencyObserver(t *testing.T) {
+	observed := map[bool][]time.Duration{}
+	cb := NewCircuitBreaker(60, 5, WithName("payments"), WithLatencyObserver(func(name string, success bool, elapsed time.Duration) {
+		if name != "payments" {
+			t.Fatal(name)
+		}
+		observed[success] = append(observed[success], elapsed)
+	}))
+	_ = cb.Execute(func() bool {
+		time.Sleep(10 * time.Millisecond)
+		return true
+	})
+	_ = cb.Call(func() bool { return false })
+	_, _ = cb.ExecuteTimed(func() bool { return false })
+	if len(observed[true]) != 1 || observed[true][0] < 10*time.Millisecond || len(observed[false]) != 2 {
+		t.Fatal(observed)
+	}
+	// 被拒绝的请求没有耗时
+	DriveToOpen(cb)
+	_ = success(cb)
+	if len(observed[true]) != 1 {
+		t.Fatal(observed)
+	}
+}
+
+func TestCircuitBreakerPercentileSlowCalls(t *testing.T) {
+	cb := NewCircuitBreaker(60, 5, WithPercentileSlowCalls(0.5, 3, 3))
+	// 直接以构造的开始时间记录耗时，避免测试真的等待
+	observe := func(elapsed time.Duration, n int) {
+		for i := 0; i < n; i++ {
+			cb.observeLatency(cb.cycle, time.Now().Add(-elapsed), cb.now(), true)
+		}
+	}
+	requireThreshold := func(base time.Duration) {
+		t.Helper()
+		if got := cb.SlowCallThreshold(); got < 3*base || got > 3*base+time.Millisecond {
+			t.Fatalf("slow call threshold is %s, want about %s", got, 3*base)
+		}
+	}
+
+	// 样本不足时不检测慢调用
+	observe(10*time.Millisecond, latencyMinSamples-1)
+	if cb.SlowCallThreshold() != 0 {
+		t.Fatal(cb.SlowCallThreshold())
+	}
+	observe(10*time.Millisecond, 1)
+	requireThreshold(10 * time.Millisecond)
+
+	// 基线逐渐升高，每一步都不超过当时阈值，阈值随之升高
+	for _, base := range []time.Duration{20 * time.Millisecond, 40 * time.Millisecond, 80 * time.Millisecond} {
+		observe(base, latencySamples)
+		RequireState(t, cb, StateClosed)
+		requireThreshold(base)
+	}
+
+	// 突然变慢时在阈值跟上之前开启
+	observe(time.Second, 2)
+	RequireState(t, cb, StateClosed)
+	observe(time.Second, 1)
+	RequireState(t, cb, StateOpen)
+}
+
+func TestCircuitBreakerSlowCallsClock(t *testing.T) {
+	now := time.Now()
+	var observed []time.Duration
+	cb := NewCircuitBreaker(60, 5,
+		WithClock(func() time.Time { return now }),
+		WithTripOnConsecutiveSlowCalls(time.Second, 2),
+		WithLatencyObserver(func(name string, success bool, elapsed time.Duration) { observed = append(observed, elapsed) }))
+	// 耗时按熔断器的时钟计算，f执行期间时钟前进2秒
+	slow := func() bool {
+		now = now.Add(2 * time.Second)
+		return true
+	}
+	_ = cb.Execute(slow)
+	if d, _ := cb.ExecuteTimed(slow); d != 2*time.Second {
+		t.Fatal(d)
+	}
+	RequireState(t, cb, StateOpen)
+	if len(observed) != 2 || observed[0] != 2*time.Second || observed[1] != 2*time.Second {
+		t.Fatal(observed)
+	}
+}
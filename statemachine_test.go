@@ -0,0 +1,214 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 本文件中的测试直接以指定的now调用refreshState、switchState和newCycle，逐个覆盖状态机的每个分支，
+// 不依赖Execute和真实的时钟
+
+// requireCycle 断言熔断器的状态和周期
+func requireCycle(t *testing.T, cb *CircuitBreaker, state, cycle uint32) {
+	t.Helper()
+	if s, c := atomic.LoadUint32(&cb.state), atomic.LoadUint32(&cb.cycle); s != state || c != cycle {
+		t.Fatalf("state=%s cycle=%d, want state=%s cycle=%d", StateString(s), c, StateString(state), cycle)
+	}
+}
+
+func TestStateMachineSwitchState(t *testing.T) {
+	var transitions []transition
+	cb := NewCircuitBreaker(60, 3, WithOnStateChange(func(_ string, from, to uint32, reason Reason, counts Counts) {
+		if counts.Failures != 2 {
+			t.Errorf("counts before the transition are %+v", counts)
+		}
+		transitions = append(transitions, transition{from, to, reason})
+	}))
+	cb.s.request()
+	cb.s.failure(cb.threshold)
+	cb.s.failure(cb.threshold)
+
+	// 当前状态与oldState不一致时CAS失败，什么也不改变
+	if cb.switchState(StateHalfOpen, StateOpen, 1000, ReasonHalfOpenFailure) {
+		t.Fatal("switched from a state the breaker is not in")
+	}
+	requireCycle(t, cb, StateClosed, 0)
+	if counts := cb.s.counts(); counts.Failures != 2 || len(transitions) != 0 {
+		t.Fatal(counts, transitions)
+	}
+
+	if !cb.switchState(StateClosed, StateOpen, 1000, ReasonThreshold) {
+		t.Fatal("switch failed")
+	}
+	requireCycle(t, cb, StateOpen, 1)
+	if cb.openExpire != 1060 || cb.stateSince != 1000 || cb.OpenCause() != CauseFailures {
+		t.Fatal(cb.openExpire, cb.stateSince, cb.OpenCause())
+	}
+	if counts := cb.s.counts(); counts != (Counts{}) {
+		t.Fatal(counts)
+	}
+	if len(transitions) != 1 || transitions[0] != (transition{StateClosed, StateOpen, ReasonThreshold}) {
+		t.Fatal(transitions)
+	}
+	// 同一个切换只有第一次成功
+	if cb.switchState(StateClosed, StateOpen, 1000, ReasonThreshold) {
+		t.Fatal("switched twice")
+	}
+	requireCycle(t, cb, StateOpen, 1)
+}
+
+func TestStateMachineNewCycle(t *testing.T) {
+	cb := NewCircuitBreaker(60, 3)
+	cb.s.request()
+	cb.s.failure(cb.threshold)
+	atomic.StoreInt64(&cb.probeStart, 900)
+
+	cb.newCycle(StateOpen, 1000)
+	if cb.cycle != 1 || cb.openExpire != 1060 || cb.probeStart != 0 || cb.s.counts() != (Counts{}) {
+		t.Fatal(cb.cycle, cb.openExpire, cb.probeStart, cb.s.counts())
+	}
+	// 进入半开启状态时清零openExpire，但保留失败的探测次数用于退避
+	atomic.StoreUint32(&cb.failedProbes, 2)
+	cb.newCycle(StateHalfOpen, 1061)
+	if cb.cycle != 2 || cb.openExpire != 0 || cb.failedProbes != 2 {
+		t.Fatal(cb.cycle, cb.openExpire, cb.failedProbes)
+	}
+	// 进入关闭状态时清零失败的探测次数
+	cb.newCycle(StateClosed, 1062)
+	if cb.cycle != 3 || cb.openExpire != 0 || cb.failedProbes != 0 {
+		t.Fatal(cb.cycle, cb.openExpire, cb.failedProbes)
+	}
+}
+
+func TestStateMachineRefreshOpenExpiry(t *testing.T) {
+	cb := NewCircuitBreaker(60, 3)
+	cb.switchState(StateClosed, StateOpen, 1000, ReasonThreshold)
+
+	// openExpire本身仍属于开启周期
+	if state, cycle := cb.refreshState(1060); state != StateOpen || cycle != 1 {
+		t.Fatal(StateString(state), cycle)
+	}
+	if state, cycle := cb.refreshState(1061); state != StateHalfOpen || cycle != 2 {
+		t.Fatal(StateString(state), cycle)
+	}
+	// 再次刷新不会重复切换
+	if state, cycle := cb.refreshState(1061); state != StateHalfOpen || cycle != 2 {
+		t.Fatal(StateString(state), cycle)
+	}
+}
+
+func TestStateMachineRefreshMaxOpenDuration(t *testing.T) {
+	cb := NewCircuitBreaker(600, 3, WithMaxOpenDuration(30*time.Second))
+	cb.switchState(StateClosed, StateOpen, 1000, ReasonThreshold)
+
+	if state, _ := cb.refreshState(1030); state != StateOpen {
+		t.Fatal(StateString(state))
+	}
+	var reason Reason
+	cb.onStateChange = func(_ string, _, _ uint32, r Reason, _ Counts) { reason = r }
+	if state, cycle := cb.refreshState(1031); state != StateHalfOpen || cycle != 2 || reason != ReasonMaxOpenDuration {
+		t.Fatal(StateString(state), cycle, reason)
+	}
+}
+
+func TestStateMachineRefreshProbeTimeout(t *testing.T) {
+	cb := NewCircuitBreaker(60, 3, WithProbeTimeout(5))
+	cb.switchState(StateClosed, StateOpen, 1000, ReasonThreshold)
+	cb.refreshState(1061)
+	requireCycle(t, cb, StateHalfOpen, 2)
+
+	// 探测请求返回后不算超时
+	cb.s.request()
+	atomic.StoreInt64(&cb.probeStart, 1061)
+	cb.s.success(cb.threshold, true)
+	if state, _ := cb.refreshState(1066); state != StateHalfOpen {
+		t.Fatal(StateString(state))
+	}
+	// 有探测请求未返回
+	cb.s.request()
+	if state, _ := cb.refreshState(1065); state != StateHalfOpen {
+		t.Fatal(StateString(state))
+	}
+	if state, cycle := cb.refreshState(1066); state != StateOpen || cycle != 3 {
+		t.Fatal(StateString(state), cycle)
+	}
+	if cb.openExpire != 1126 || cb.OpenCause() != CauseBackoff || cb.failedProbes != 1 {
+		t.Fatal(cb.openExpire, cb.OpenCause(), cb.failedProbes)
+	}
+}
+
+func TestStateMachineRefreshConfirmWindow(t *testing.T) {
+	cb := NewCircuitBreaker(60, 3, WithRecoveryConfirmWindow(10*time.Second))
+	cb.switchState(StateClosed, StateOpen, 1000, ReasonThreshold)
+	cb.refreshState(1061)
+
+	// 确认窗口还没有开始
+	if state, _ := cb.refreshState(2000); state != StateHalfOpen {
+		t.Fatal(StateString(state))
+	}
+	atomic.StoreInt64(&cb.confirmAt, 2010)
+	if state, _ := cb.refreshState(2009); state != StateHalfOpen {
+		t.Fatal(StateString(state))
+	}
+	if state, cycle := cb.refreshState(2010); state != StateClosed || cycle != 3 {
+		t.Fatal(StateString(state), cycle)
+	}
+	if cb.confirmAt != 0 || cb.recoveredAt != 2010 {
+		t.Fatal(cb.confirmAt, cb.recoveredAt)
+	}
+}
+
+func TestStateMachineRefreshStaleProbeReset(t *testing.T) {
+	cb := NewCircuitBreaker(60, 3, WithStaleProbeReset(5*time.Second))
+	cb.switchState(StateClosed, StateOpen, 1000, ReasonThreshold)
+	cb.refreshState(1061)
+	for i := 0; i < 3; i++ {
+		cb.s.request()
+	}
+	cb.s.success(cb.threshold, true)
+	atomic.StoreInt64(&cb.lastProbeResolved, 1062)
+
+	cb.refreshState(1066)
+	if requests := cb.s.counts().Requests; requests != 3 {
+		t.Fatal(requests)
+	}
+	// 归还未返回的探测请求占用的名额，不切换状态
+	if state, cycle := cb.refreshState(1067); state != StateHalfOpen || cycle != 2 {
+		t.Fatal(StateString(state), cycle)
+	}
+	if requests := cb.s.counts().Requests; requests != 1 {
+		t.Fatal(requests)
+	}
+}
+
+func TestStateMachineRefreshShared(t *testing.T) {
+	shared := NewSharedStatistic(10, 6)
+	cb := NewCircuitBreaker(60, 2, WithSharedStatistic(shared))
+	shared.window.record(1000, false)
+	if state, _ := cb.refreshState(1000); state != StateClosed {
+		t.Fatal(StateString(state))
+	}
+	shared.window.record(1000, false)
+	if state, cycle := cb.refreshState(1000); state != StateOpen || cycle != 1 {
+		t.Fatal(StateString(state), cycle)
+	}
+	// 失败移出共享统计的窗口后不影响开启状态
+	if state, _ := cb.refreshState(1060); state != StateOpen {
+		t.Fatal(StateString(state))
+	}
+}
+
+func TestStateMachineRefreshIdle(t *testing.T) {
+	cb := NewCircuitBreaker(60, 3)
+	for _, now := range []int64{0, 1000, 1 << 40} {
+		if state, cycle := cb.refreshState(now); state != StateClosed || cycle != 0 {
+			t.Fatal(now, StateString(state), cycle)
+		}
+	}
+	// 半开启状态下没有任何配置时只能由请求结果驱动
+	cb.switchState(StateClosed, StateHalfOpen, 1000, ReasonManual)
+	if state, cycle := cb.refreshState(1 << 40); state != StateHalfOpen || cycle != 1 {
+		t.Fatal(StateString(state), cycle)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// TransitionStrategy 决定熔断器何时切换状态，通过WithTransitionStrategy配置后替换内置的状态切换规则
+// 每个方法返回熔断器需要切换到的状态以及切换原因，返回当前状态表示不切换
+// 状态不限于StateClosed、StateHalfOpen、StateOpen三种，但放行判断仍由AdmissionPolicy按这三种状态进行，
+// 其它状态下的请求按关闭状态判断
+type TransitionStrategy interface {
+	// AfterSuccess 请求成功并计入统计之后调用，counts包含这次成功
+	AfterSuccess(state uint32, counts Counts) (to uint32, reason Reason)
+	// AfterFailure 请求失败并计入统计之后调用，counts包含这次失败
+	AfterFailure(state uint32, counts Counts) (to uint32, reason Reason)
+	// Refresh 每次访问熔断器状态时调用，elapsed为处于当前状态的时间，精度为秒
+	Refresh(state uint32, counts Counts, elapsed time.Duration) (to uint32, reason Reason)
+}
+
+// ConsecutiveTransitionStrategy 只按连续失败和连续成功切换的三状态规则，可以作为自定义规则的基础：
+// 关闭状态下连续失败达到Threshold时开启，开启OpenInterval秒后切换到半开启，
+// 半开启状态下连续成功达到Threshold时关闭、任意一次失败重新开启
+// 没有配置WithTransitionStrategy时熔断器使用内置的规则而不是这个类型；两者在不使用滑动窗口、失败率、探测超时等可选功能时行为相同
+type ConsecutiveTransitionStrategy struct {
+	OpenInterval int64
+	Threshold    uint32
+}
+
+func (s ConsecutiveTransitionStrategy) AfterSuccess(state uint32, counts Counts) (uint32, Reason) {
+	if counts.ContinuousSuccesses >= s.Threshold {
+		switch state {
+		case StateHalfOpen:
+			return StateClosed, ReasonHalfOpenRecovered
+		case StateOpen:
+			return StateHalfOpen, ReasonOpenRecovered
+		}
+	}
+	return state, 0
+}
+
+func (s ConsecutiveTransitionStrategy) AfterFailure(state uint32, counts Counts) (uint32, Reason) {
+	switch state {
+	case StateClosed:
+		if counts.ContinuousFailures >= s.Threshold {
+			return StateOpen, ReasonThreshold
+		}
+	case StateHalfOpen:
+		return StateOpen, ReasonHalfOpenFailure
+	}
+	return state, 0
+}
+
+func (s ConsecutiveTransitionStrategy) Refresh(state uint32, counts Counts, elapsed time.Duration) (uint32, Reason) {
+	if state == StateOpen && elapsed > time.Duration(s.OpenInterval)*time.Second {
+		return StateHalfOpen, ReasonIntervalElapsed
+	}
+	return state, 0
+}
+
+// strategySuccess 配置了TransitionStrategy时记录一次成功并按规则切换状态
+func (cb *CircuitBreaker) strategySuccess(state uint32, now int64, n uint32) {
+	cb.s.successN(cb.threshold, state != StateClosed || cb.resetFailuresOnSuccess, n)
+	to, reason := cb.strategy.AfterSuccess(state, cb.s.counts())
+	cb.strategySwitch(state, to, now, reason)
+}
+
+// strategyFailure 配置了TransitionStrategy时记录一次失败并按规则切换状态
+func (cb *CircuitBreaker) strategyFailure(state uint32, now int64, n uint32) {
+	cb.s.failureN(cb.threshold, n)
+	to, reason := cb.strategy.AfterFailure(state, cb.s.counts())
+	cb.strategySwitch(state, to, now, reason)
+}
+
+// strategyRefresh 配置了TransitionStrategy时代替内置的开启周期和探测超时判断
+func (cb *CircuitBreaker) strategyRefresh(now int64) {
+	state := atomic.LoadUint32(&cb.state)
+	elapsed := time.Duration(now-atomic.LoadInt64(&cb.stateSince)) * time.Second
+	to, reason := cb.strategy.Refresh(state, cb.s.counts(), elapsed)
+	cb.strategySwitch(state, to, now, reason)
+}
+
+func (cb *CircuitBreaker) strategySwitch(from, to uint32, now int64, reason Reason) {
+	if to != from {
+		cb.switchState(from, to, now, reason)
+	}
+}
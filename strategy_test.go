@@ -0,0 +1,80 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// twoStateStrategy 没有半开启状态，开启5秒后直接关闭
+type twoStateStrategy struct{}
+
+func (twoStateStrategy) AfterSuccess(state uint32, counts Counts) (uint32, Reason) {
+	return state, 0
+}
+
+func (twoStateStrategy) AfterFailure(state uint32, counts Counts) (uint32, Reason) {
+	if state == StateClosed && counts.ContinuousFailures >= 2 {
+		return StateOpen, ReasonThreshold
+	}
+	return state, 0
+}
+
+func (twoStateStrategy) Refresh(state uint32, counts Counts, elapsed time.Duration) (uint32, Reason) {
+	if state == StateOpen && elapsed >= 5*time.Second {
+		return StateClosed, ReasonManual
+	}
+	return state, 0
+}
+
+func TestCircuitBreakerTransitionStrategy(t *testing.T) {
+	var got []transition
+	cb := NewCircuitBreaker(60, 5, WithTransitionStrategy(twoStateStrategy{}),
+		WithOnStateChange(func(name string, from, to uint32, reason Reason, counts Counts) {
+			got = append(got, transition{from, to, reason})
+		}))
+	_ = fail(cb)
+	_ = fail(cb)
+	RequireState(t, cb, StateOpen)
+	if err := success(cb); err != ErrOpenState {
+		t.Fatal(err)
+	}
+	advance(cb, 4*time.Second)
+	RequireState(t, cb, StateOpen)
+	advance(cb, time.Second)
+	RequireState(t, cb, StateClosed)
+	want := []transition{
+		{StateClosed, StateOpen, ReasonThreshold},
+		{StateOpen, StateClosed, ReasonManual},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatal(got)
+	}
+}
+
+func TestConsecutiveTransitionStrategy(t *testing.T) {
+	// 内置规则与ConsecutiveTransitionStrategy对同样的请求序列给出同样的状态切换
+	run := func(opts ...Option) []transition {
+		var got []transition
+		opts = append(opts, WithOnStateChange(func(name string, from, to uint32, reason Reason, counts Counts) {
+			got = append(got, transition{from, to, reason})
+		}))
+		cb := NewCircuitBreaker(10, 3, opts...)
+		for _, step := range []string{"fff", "wait", "f", "wait", "sss", "fsfff"} {
+			if step == "wait" {
+				advance(cb, 11*time.Second)
+				cb.State()
+				continue
+			}
+			for _, c := range step {
+				_ = cb.Execute(func() bool { return c == 's' })
+			}
+		}
+		return got
+	}
+	builtin := run()
+	custom := run(WithTransitionStrategy(ConsecutiveTransitionStrategy{OpenInterval: 10, Threshold: 3}))
+	if len(builtin) != 6 || !reflect.DeepEqual(builtin, custom) {
+		t.Fatal(builtin, custom)
+	}
+}
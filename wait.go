@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// watchers 订阅熔断器状态切换以及半开启状态下探测名额释放的通道集合
+type watchers struct {
+	mu    sync.Mutex
+	chans map[chan struct{}]struct{}
+}
+
+// watch 订阅状态切换，每次切换后向返回的通道发送一个信号，调用stop取消订阅
+// 通道的缓冲为1，接收不及时时多次切换只会收到一个信号
+func (w *watchers) watch() (ch <-chan struct{}, stop func()) {
+	c := make(chan struct{}, 1)
+	w.mu.Lock()
+	if w.chans == nil {
+		w.chans = make(map[chan struct{}]struct{})
+	}
+	w.chans[c] = struct{}{}
+	w.mu.Unlock()
+	return c, func() {
+		w.mu.Lock()
+		delete(w.chans, c)
+		w.mu.Unlock()
+	}
+}
+
+func (w *watchers) notify() {
+	w.mu.Lock()
+	for c := range w.chans {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+	w.mu.Unlock()
+}
+
+// WaitForState 阻塞直到熔断器切换到target状态或ctx结束，ctx结束时返回ctx.Err()
+// 开启状态到半开启状态的切换只会在访问熔断器时发生，因此在开启状态下会等到开启周期结束后主动刷新一次状态
+// 熔断器已经通过Shutdown停止使用时返回ErrShutdown
+// 主要用于测试和编排，不应在请求处理的关键路径上使用
+func (cb *CircuitBreaker) WaitForState(ctx context.Context, target uint32) error {
+	ch, stop := cb.watchers.watch()
+	defer stop()
+	for {
+		if cb.IsShutdown() {
+			return ErrShutdown
+		}
+		state := cb.State()
+		if state == target {
+			return nil
+		}
+		var timer *time.Timer
+		var expired <-chan time.Time
+		if state == StateOpen {
+			expire := atomic.LoadInt64(&cb.openExpire)
+			if cb.maxOpenDuration > 0 && cb.maxOpenExpire() < expire {
+				expire = cb.maxOpenExpire()
+			}
+			// 自定义的TransitionStrategy可能在开启周期结束后仍保持开启状态，此时每秒刷新一次状态，避免空转
+			remaining := expire + 1 - cb.now()
+			if remaining < 1 {
+				remaining = 1
+			}
+			timer = time.NewTimer(time.Duration(remaining) * time.Second)
+			expired = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-ch:
+		case <-expired:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
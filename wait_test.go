@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerWaitForState(t *testing.T) {
+	cb := NewCircuitBreaker(1, 3)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go func() {
+		for i := 0; i < 3; i++ {
+			_ = fail(cb)
+		}
+	}()
+	if err := cb.WaitForState(ctx, StateOpen); err != nil {
+		t.Fatal(err)
+	}
+	// 没有请求时也能在开启周期结束后切换到半开启状态
+	if err := cb.WaitForState(ctx, StateHalfOpen); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for i := 0; i < 3; i++ {
+			_ = success(cb)
+		}
+	}()
+	if err := cb.WaitForState(ctx, StateClosed); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCircuitBreakerWaitForStateTimeout(t *testing.T) {
+	cb := NewCircuitBreaker(60, 3)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := cb.WaitForState(ctx, StateOpen); err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+	if len(cb.watchers.chans) != 0 {
+		t.Fatal(len(cb.watchers.chans))
+	}
+}
+
+// stayOpenStrategy 开启后一直保持开启状态，并记录Refresh的调用次数
+type stayOpenStrategy struct {
+	twoStateStrategy
+	refreshes *int32
+}
+
+func (s stayOpenStrategy) Refresh(state uint32, counts Counts, elapsed time.Duration) (uint32, Reason) {
+	atomic.AddInt32(s.refreshes, 1)
+	return state, 0
+}
+
+func TestCircuitBreakerWaitForStatePastOpenExpire(t *testing.T) {
+	var refreshes int32
+	cb := NewCircuitBreaker(60, 5, WithTransitionStrategy(stayOpenStrategy{refreshes: &refreshes}))
+	_ = fail(cb)
+	_ = fail(cb)
+	RequireState(t, cb, StateOpen)
+	// 开启周期已经结束，但自定义规则保持开启状态，等待期间不应空转
+	advance(cb, 61*time.Second)
+	atomic.StoreInt32(&refreshes, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := cb.WaitForState(ctx, StateClosed); err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&refreshes); n > 5 {
+		t.Fatal("busy loop", n)
+	}
+}
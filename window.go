@@ -0,0 +1,90 @@
+package main
+
+import "sync"
+
+// bucket 时间窗口中一个桶的统计数据
+type bucket struct {
+	successes uint32
+	failures  uint32
+}
+
+// bucketedWindow 按时间分桶的滑动窗口
+// 窗口不依赖后台协程，只在被访问时根据当前时间淘汰过期的桶
+// 熔断器空闲时过期的桶会一直保留到下一次访问，但读取聚合数据前总会先淘汰过期的桶，因此不会读到过期数据
+type bucketedWindow struct {
+	mu       sync.Mutex
+	interval int64 // 每个桶的时间跨度，单位秒
+	buckets  []bucket
+	head     int64 // 最新的桶对应的时间段编号，即now / interval
+}
+
+func newBucketedWindow(interval int64, n int) *bucketedWindow {
+	return &bucketedWindow{
+		interval: interval,
+		buckets:  make([]bucket, n),
+	}
+}
+
+// rotate 淘汰now之前已经移出窗口的桶，调用方需持有锁
+func (w *bucketedWindow) rotate(now int64) {
+	idx := now / w.interval
+	if idx <= w.head {
+		// 时间回拨时仍然写入最新的桶
+		return
+	}
+	n := int64(len(w.buckets))
+	if idx-w.head >= n {
+		for i := range w.buckets {
+			w.buckets[i] = bucket{}
+		}
+	} else {
+		for i := w.head + 1; i <= idx; i++ {
+			w.buckets[i%n] = bucket{}
+		}
+	}
+	w.head = idx
+}
+
+// record 记录一次请求结果，返回记录后窗口内的聚合数据
+func (w *bucketedWindow) record(now int64, success bool) bucket {
+	return w.recordN(now, success, 1)
+}
+
+// recordN 将一次请求结果按n次记录，返回记录后窗口内的聚合数据
+func (w *bucketedWindow) recordN(now int64, success bool, n uint32) bucket {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.rotate(now)
+	b := &w.buckets[w.head%int64(len(w.buckets))]
+	if success {
+		b.successes += n
+	} else {
+		b.failures += n
+	}
+	return w.sum()
+}
+
+// aggregate 返回窗口内的聚合数据
+func (w *bucketedWindow) aggregate(now int64) bucket {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.rotate(now)
+	return w.sum()
+}
+
+func (w *bucketedWindow) sum() bucket {
+	var total bucket
+	for _, b := range w.buckets {
+		total.successes += b.successes
+		total.failures += b.failures
+	}
+	return total
+}
+
+func (w *bucketedWindow) clear() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i := range w.buckets {
+		w.buckets[i] = bucket{}
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketedWindowRotate(t *testing.T) {
+	w := newBucketedWindow(10, 3)
+	w.record(100, false)
+	w.record(105, true)
+	w.record(112, false)
+	if b := w.aggregate(125); b.successes != 1 || b.failures != 2 {
+		t.Fatal(b)
+	}
+	// 100~109的桶过期
+	if b := w.aggregate(130); b.successes != 0 || b.failures != 1 {
+		t.Fatal(b)
+	}
+	// 所有桶过期
+	if b := w.aggregate(200); b.successes != 0 || b.failures != 0 {
+		t.Fatal(b)
+	}
+	// 时间回拨时写入最新的桶
+	w.record(150, false)
+	if b := w.aggregate(200); b.failures != 1 {
+		t.Fatal(b)
+	}
+}
+
+func TestCircuitBreakerBucketedWindow(t *testing.T) {
+	cb := NewCircuitBreaker(60, 3, WithBucketedWindow(10, 3))
+	now := time.Unix(1000, 0)
+	ok := func() bool { return true }
+	ko := func() bool { return false }
+	// 失败之间夹杂成功，仍然在窗口内累计失败数
+	for _, f := range []func() bool{ko, ok, ko, ok} {
+		if err := cb.ExecuteAt(now, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 之前的失败已经移出窗口
+	now = now.Add(30 * time.Second)
+	if err := cb.ExecuteAt(now, ko); err != nil {
+		t.Fatal(err)
+	}
+	if cb.state != StateClosed {
+		t.Fatal(cb.state)
+	}
+	now = now.Add(10 * time.Second)
+	if err := cb.ExecuteAt(now, ko); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(10 * time.Second)
+	if err := cb.ExecuteAt(now, ko); err != nil {
+		t.Fatal(err)
+	}
+	if cb.state != StateOpen {
+		t.Fatal(cb.state)
+	}
+}
+
+func TestCircuitBreakerIgnoreIsolatedFailures(t *testing.T) {
+	ok := func() bool { return true }
+	ko := func() bool { return false }
+	isolated := []func() bool{ko, ok, ko, ok, ko, ok}
+	for _, ignore := range []bool{false, true} {
+		opts := []Option{WithBucketedWindow(10, 6)}
+		if ignore {
+			opts = append(opts, WithIgnoreIsolatedFailures())
+		}
+		cb := NewCircuitBreaker(60, 2, opts...)
+		now := time.Unix(1000, 0)
+		for _, f := range isolated {
+			_ = cb.ExecuteAt(now, f)
+		}
+		if ignore {
+			if cb.state != StateClosed || cb.s.failures != 0 {
+				t.Fatal(cb.state, cb.s.failures)
+			}
+		} else if cb.state != StateOpen {
+			t.Fatal(cb.state)
+		}
+		if !ignore {
+			continue
+		}
+		// 连续的失败仍然会开启熔断器
+		_ = cb.ExecuteAt(now, ko)
+		_ = cb.ExecuteAt(now, ko)
+		if cb.state != StateOpen {
+			t.Fatal(cb.state)
+		}
+	}
+
+	// 连续失败模式下阈值为1时也需要连续失败两次
+	cb := NewCircuitBreaker(60, 1, WithIgnoreIsolatedFailures())
+	_ = fail(cb)
+	_ = success(cb)
+	_ = fail(cb)
+	if cb.State() != StateClosed {
+		t.Fatal(cb.State())
+	}
+	_ = fail(cb)
+	if cb.State() != StateOpen {
+		t.Fatal(cb.State())
+	}
+}
+
+func TestCircuitBreakerSharedStatistic(t *testing.T) {
+	shared := NewSharedStatistic(10, 6)
+	a := NewCircuitBreaker(60, 4, WithSharedStatistic(shared))
+	b := NewCircuitBreaker(60, 4, WithSharedStatistic(shared))
+	ko := func() bool { return false }
+	// 两个熔断器各失败两次，单独都达不到阈值，合计达到阈值
+	for _, cb := range []*CircuitBreaker{a, b, a} {
+		if err := cb.Execute(ko); err != nil {
+			t.Fatal(err)
+		}
+		RequireState(t, cb, StateClosed)
+	}
+	if err := b.Execute(ko); err != nil {
+		t.Fatal(err)
+	}
+	RequireState(t, b, StateOpen)
+	// a没有再记录失败，下一次访问时因共享统计开启
+	RequireState(t, a, StateOpen)
+	if err := a.Execute(ko); err != ErrOpenState {
+		t.Fatal(err)
+	}
+
+	// 状态机仍然各自独立：a恢复后清空共享统计，b保持开启直到自己的探测成功
+	DriveToHalfOpen(a)
+	for i := 0; i < 4; i++ {
+		success(a)
+	}
+	RequireState(t, a, StateClosed)
+	RequireState(t, b, StateOpen)
+	if err := a.Execute(ko); err != nil {
+		t.Fatal(err)
+	}
+	RequireState(t, a, StateClosed)
+}